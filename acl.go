@@ -0,0 +1,231 @@
+package restserver
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+// Access is the level of access a user has to a repository.
+type Access int
+
+// Define all access levels, ordered from least to most privileged.
+const (
+	AccessNone   Access = iota // the repository cannot be accessed at all
+	AccessRead                 // the repository can only be read
+	AccessAppend               // new data can be added, but nothing can be deleted
+	AccessFull                 // no restrictions
+)
+
+// ParseAccess parses the name of an access level as used in the ACL file.
+func ParseAccess(s string) (Access, error) {
+	switch s {
+	case "none":
+		return AccessNone, nil
+	case "read":
+		return AccessRead, nil
+	case "append":
+		return AccessAppend, nil
+	case "full":
+		return AccessFull, nil
+	}
+	return AccessNone, fmt.Errorf("invalid access level %q, must be one of none, read, append or full", s)
+}
+
+func (a Access) String() string {
+	switch a {
+	case AccessRead:
+		return "read"
+	case AccessAppend:
+		return "append"
+	case AccessFull:
+		return "full"
+	}
+	return "none"
+}
+
+// aclRule grants access to all repositories matching pattern.
+type aclRule struct {
+	pattern   string // path.Match pattern, may contain the {user} placeholder
+	principal string // a username, "@group" or "*" for all users
+	access    Access
+}
+
+// ACLFile holds the access control list loaded from a file. Each non-empty
+// line which is not a comment either defines a group or grants access:
+//
+//	group <name> <user>...
+//	<repository pattern> <user, @group or *> <none|read|append|full>
+//
+// Repository patterns use the syntax of path.Match and are matched against the
+// repository path, for example "/team-a/*". The placeholder {user} is replaced
+// with the name of the authenticated user. If several rules match, the highest
+// access level wins. Users without a matching rule cannot access a repository.
+//
+// If Groups is set, groups referenced by "@group" are also looked up there.
+type ACLFile struct {
+	Groups *GroupFile
+
+	mutex  sync.Mutex
+	file   *watchedFile
+	rules  []aclRule
+	groups map[string]map[string]bool
+}
+
+// NewACLFromFile reads the access control list from path. The file is reloaded
+// when it changes on disk or when the process receives SIGHUP.
+func NewACLFromFile(path string) (*ACLFile, error) {
+	file, err := newWatchedFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &ACLFile{file: file}
+	if err := a.Reload(); err != nil {
+		return nil, err
+	}
+
+	reloadOnSIGHUP("ACL file", a.Reload)
+
+	return a, nil
+}
+
+// Reload reloads the ACL file. If the file cannot be parsed, the previous rules
+// are kept and the error is returned.
+func (a *ACLFile) Reload() error {
+	rules, groups, err := parseACLFile(a.file.path)
+	if err != nil {
+		return err
+	}
+
+	a.mutex.Lock()
+	a.rules = rules
+	a.groups = groups
+	a.mutex.Unlock()
+	return nil
+}
+
+func parseACLFile(filename string) ([]aclRule, map[string]map[string]bool, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	var rules []aclRule
+	groups := make(map[string]map[string]bool)
+
+	sc := bufio.NewScanner(f)
+	for lineNo := 1; sc.Scan(); lineNo++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+
+		if fields[0] == "group" {
+			if len(fields) < 2 {
+				return nil, nil, fmt.Errorf("%s:%d: missing group name", filename, lineNo)
+			}
+			members := groups[fields[1]]
+			if members == nil {
+				members = make(map[string]bool)
+				groups[fields[1]] = members
+			}
+			for _, user := range fields[2:] {
+				members[user] = true
+			}
+			continue
+		}
+
+		if len(fields) != 3 {
+			return nil, nil, fmt.Errorf("%s:%d: expected <repository> <principal> <access>, got %q", filename, lineNo, line)
+		}
+		pattern := fields[0]
+		if !strings.HasPrefix(pattern, "/") {
+			return nil, nil, fmt.Errorf("%s:%d: repository pattern %q must start with /", filename, lineNo, pattern)
+		}
+		if len(pattern) > 1 {
+			pattern = strings.TrimSuffix(pattern, "/")
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, nil, fmt.Errorf("%s:%d: invalid repository pattern %q: %v", filename, lineNo, pattern, err)
+		}
+		access, err := ParseAccess(fields[2])
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s:%d: %v", filename, lineNo, err)
+		}
+		rules = append(rules, aclRule{pattern: pattern, principal: fields[1], access: access})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, nil, err
+	}
+	return rules, groups, nil
+}
+
+// ReloadCheck reloads the ACL file if it changed on disk.
+func (a *ACLFile) ReloadCheck() {
+	if !a.file.changed() {
+		return
+	}
+	if err := a.Reload(); err != nil {
+		log.Printf("Could not reload ACL file: %v", err)
+		return
+	}
+	log.Printf("Reloaded ACL file")
+}
+
+// Access returns the access level username has for the repository at
+// folderPath.
+func (a *ACLFile) Access(username string, folderPath []string) Access {
+	a.ReloadCheck()
+
+	repoPath := "/" + strings.Join(folderPath, "/")
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	access := AccessNone
+	for _, rule := range a.rules {
+		if rule.access <= access || !a.matchesPrincipal(rule.principal, username) {
+			continue
+		}
+		pattern := strings.ReplaceAll(rule.pattern, "{user}", escapePattern(username))
+		if ok, _ := path.Match(pattern, repoPath); ok {
+			access = rule.access
+		}
+	}
+	return access
+}
+
+// matchesPrincipal returns true if principal refers to username. The caller
+// must hold a.mutex.
+func (a *ACLFile) matchesPrincipal(principal, username string) bool {
+	switch {
+	case principal == "*":
+		return true
+	case strings.HasPrefix(principal, "@"):
+		group := principal[1:]
+		return a.groups[group][username] || (a.Groups != nil && a.Groups.IsMember(username, group))
+	}
+	return principal == username
+}
+
+// escapePattern escapes all characters in s which have a special meaning for
+// path.Match.
+func escapePattern(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		if strings.ContainsRune(`*?[]\`, c) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,112 @@
+package restserver
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testACL = `
+# shared repositories
+/shared/db   ops      full
+/shared/db   @agents  append
+/team-a/*    @team-a  append
+/{user}      *        full
+/{user}/*    *        full
+/public      *        read
+
+group agents host1 host2
+group team-a alice
+`
+
+func writeTestACL(t *testing.T, content string) string {
+	fn := filepath.Join(t.TempDir(), "acl")
+	if err := os.WriteFile(fn, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return fn
+}
+
+func TestACLAccess(t *testing.T) {
+	acl, err := NewACLFromFile(writeTestACL(t, testACL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		user   string
+		repo   string
+		access Access
+	}{
+		{"ops", "/shared/db", AccessFull},
+		{"host1", "/shared/db", AccessAppend},
+		{"host3", "/shared/db", AccessNone},
+		{"alice", "/team-a/laptop", AccessAppend},
+		{"alice", "/team-a", AccessNone},
+		{"bob", "/team-a/laptop", AccessNone},
+		{"bob", "/bob", AccessFull},
+		{"bob", "/bob/laptop", AccessFull},
+		{"bob", "/alice/laptop", AccessNone},
+		{"bob", "/public", AccessRead},
+		{"b*", "/bob", AccessNone},
+		{"bob", "/", AccessNone},
+	}
+
+	for _, test := range tests {
+		folderPath := strings.Split(strings.TrimPrefix(test.repo, "/"), "/")
+		if test.repo == "/" {
+			folderPath = nil
+		}
+		access := acl.Access(test.user, folderPath)
+		if access != test.access {
+			t.Errorf("%v on %v: want access %v, got %v", test.user, test.repo, test.access, access)
+		}
+	}
+}
+
+func TestACLInvalid(t *testing.T) {
+	for _, content := range []string{
+		"/repo user",
+		"repo user full",
+		"/repo user write",
+		"/repo[ user full",
+		"group",
+	} {
+		_, err := NewACLFromFile(writeTestACL(t, content))
+		if err == nil {
+			t.Errorf("expected error for ACL %q", content)
+		}
+	}
+}
+
+func TestACLHandler(t *testing.T) {
+	mux, data, fileID, _, cleanup := createTestHandler(t, &Server{
+		ProxyAuthUsername: "X-Remote-User",
+		ACLPath:           writeTestACL(t, testACL),
+		PanicOnError:      true,
+	})
+	defer cleanup()
+
+	request := func(user, method, path, body string) *http.Request {
+		req := newRequest(t, method, path, strings.NewReader(body))
+		req.Header.Set("X-Remote-User", user)
+		return req
+	}
+
+	for _, test := range []struct {
+		req  *http.Request
+		code int
+	}{
+		{request("ops", "POST", "/shared/db/?create=true", ""), http.StatusOK},
+		{request("host1", "POST", "/shared/db/data/"+fileID, data), http.StatusOK},
+		{request("host1", "DELETE", "/shared/db/data/"+fileID, ""), http.StatusForbidden},
+		{request("host3", "GET", "/shared/db/data/"+fileID, ""), http.StatusForbidden},
+		{request("ops", "DELETE", "/shared/db/data/"+fileID, ""), http.StatusOK},
+		{request("ops", "POST", "/public/?create=true", ""), http.StatusForbidden},
+		{request("alice", "POST", "/alice/?create=true", ""), http.StatusOK},
+	} {
+		checkRequest(t, mux.ServeHTTP, test.req, []wantFunc{wantCode(test.code)})
+	}
+}
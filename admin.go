@@ -0,0 +1,401 @@
+package restserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/restic/rest-server/quota"
+	"github.com/restic/rest-server/repo"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// The admin API is mounted below AdminPrefix when Server.AdminAPI is set. It
+// can only be used by users with the "admin" attribute in the htpasswd file.
+//
+//	GET    /_admin/users               list users
+//	POST   /_admin/users               create a user
+//	GET    /_admin/repos               list repositories and their sizes
+//	DELETE /_admin/repos/{path...}     delete a repository
+//	PATCH  /_admin/repos/{path...}     rename a repository
+//	POST   /_admin/unfreeze/{path...}  unfreeze a repository frozen due to mass deletion
+//	GET    /_admin/trash/{path...}     list the trash of a repository
+//	POST   /_admin/trash/{path...}     restore a file from the trash
+//	GET    /_admin/holds/{path...}     list the legal holds in a repository
+//	POST   /_admin/holds/{path...}     place a legal hold on an object
+//	DELETE /_admin/holds/{path...}     release a legal hold
+//	GET    /_admin/pending/{path...}   list the deletions awaiting approval in a protected repository
+//	POST   /_admin/pending/{path...}   approve a deletion
+//	DELETE /_admin/pending/{path...}   reject a deletion
+//	POST   /_admin/reload              reload the htpasswd file
+//	GET    /_admin/quota               show the quota usage
+const AdminPrefix = "/_admin/"
+
+// AdminUser is a user as returned and accepted by the admin API.
+type AdminUser struct {
+	Username   string   `json:"username"`
+	Password   string   `json:"password,omitempty"`
+	Attributes []string `json:"attributes,omitempty"`
+	CreateRepo bool     `json:"create_repo,omitempty"`
+}
+
+// AdminRepo is a repository as returned by the admin API.
+type AdminRepo struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	Frozen bool   `json:"frozen,omitempty"`
+}
+
+// AdminQuota is the quota usage as returned by the admin API.
+type AdminQuota struct {
+	MaxRepoSize    int64 `json:"max_repo_size"`
+	SpaceUsed      int64 `json:"space_used"`
+	SpaceRemaining int64 `json:"space_remaining"`
+}
+
+// adminUserKey is the context key for the name of the authenticated admin.
+type adminUserKey struct{}
+
+// adminUsername returns the name of the admin who sent r.
+func adminUsername(r *http.Request) string {
+	username, _ := r.Context().Value(adminUserKey{}).(string)
+	return username
+}
+
+func (s *Server) wrapAdminAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := s.authenticate(w, r)
+		if !ok {
+			return
+		}
+		if !id.admin {
+			httpDefaultError(w, http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), adminUserKey{}, id.username)))
+	})
+}
+
+// adminHandler returns the handler for the admin API.
+func (s *Server) adminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /_admin/users", s.adminListUsers)
+	mux.HandleFunc("POST /_admin/users", s.adminCreateUser)
+	mux.HandleFunc("GET /_admin/repos", s.adminListRepos)
+	mux.HandleFunc("DELETE /_admin/repos/{path...}", s.adminDeleteRepo)
+	mux.HandleFunc("PATCH /_admin/repos/{path...}", s.adminRenameRepo)
+	mux.HandleFunc("POST /_admin/unfreeze/{path...}", s.adminUnfreezeRepo)
+	mux.HandleFunc("GET /_admin/trash/{path...}", s.adminListTrash)
+	mux.HandleFunc("POST /_admin/trash/{path...}", s.adminRestoreTrash)
+	mux.HandleFunc("GET /_admin/holds/{path...}", s.adminListHolds)
+	mux.HandleFunc("POST /_admin/holds/{path...}", s.adminPlaceHold)
+	mux.HandleFunc("DELETE /_admin/holds/{path...}", s.adminReleaseHold)
+	mux.HandleFunc("GET /_admin/pending/{path...}", s.adminListPending)
+	mux.HandleFunc("POST /_admin/pending/{path...}", s.adminApprovePending)
+	mux.HandleFunc("DELETE /_admin/pending/{path...}", s.adminRejectPending)
+	mux.HandleFunc("POST /_admin/reload", s.adminReload)
+	mux.HandleFunc("GET /_admin/quota", s.adminQuota)
+	return s.wrapAdminAuth(mux)
+}
+
+func sendJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("error sending response: %v", err)
+	}
+}
+
+func (s *Server) adminListUsers(w http.ResponseWriter, _ *http.Request) {
+	entries, err := ReadHtpasswdEntries(s.HtpasswdPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("admin: cannot read %s: %v", s.HtpasswdPath, err)
+		httpDefaultError(w, http.StatusInternalServerError)
+		return
+	}
+	users := make([]AdminUser, 0, len(entries))
+	for _, e := range entries {
+		users = append(users, AdminUser{Username: e.Username, Attributes: e.Attributes})
+	}
+	sendJSON(w, http.StatusOK, users)
+}
+
+func (s *Server) adminCreateUser(w http.ResponseWriter, r *http.Request) {
+	var user AdminUser
+	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !ValidUsername(user.Username) || user.Password == "" {
+		http.Error(w, "invalid username or empty password", http.StatusBadRequest)
+		return
+	}
+	if slices.Contains(repo.ReservedNames, user.Username) {
+		http.Error(w, fmt.Sprintf("username %q is reserved", user.Username), http.StatusBadRequest)
+		return
+	}
+	for _, attr := range user.Attributes {
+		if !validAttribute(attr) {
+			http.Error(w, fmt.Sprintf("invalid attribute %q", attr), http.StatusBadRequest)
+			return
+		}
+	}
+
+	err := AddHtpasswdUser(s.HtpasswdPath, user.Username, user.Password, user.Attributes)
+	switch {
+	case errors.Is(err, ErrUserExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case errors.Is(err, bcrypt.ErrPasswordTooLong):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		log.Printf("admin: cannot add user %s: %v", user.Username, err)
+		httpDefaultError(w, http.StatusInternalServerError)
+		return
+	}
+	if err := s.htpasswdFile.Reload(); err != nil {
+		log.Printf("admin: cannot reload %s: %v", s.HtpasswdPath, err)
+	}
+	log.Printf("admin: added user %s", user.Username)
+
+	if user.CreateRepo {
+		if err := os.MkdirAll(filepath.Join(s.Path, user.Username), s.repoDirMode()); err != nil {
+			log.Printf("admin: cannot create repository for %s: %v", user.Username, err)
+			httpDefaultError(w, http.StatusInternalServerError)
+			return
+		}
+	}
+	sendJSON(w, http.StatusCreated, AdminUser{Username: user.Username, Attributes: user.Attributes})
+}
+
+// repoDirMode returns the mode of directories created for repositories, which
+// matches the mode used by the repository handler.
+func (s *Server) repoDirMode() os.FileMode {
+	if s.GroupAccessibleRepos {
+		return repo.GroupAccessibleDirMode
+	}
+	return repo.DefaultDirMode
+}
+
+// adminRepoPath parses the path of a repository as used in the admin API and
+// returns its location in the filesystem.
+func (s *Server) adminRepoPath(repoPath string) (string, bool) {
+	folderPath := strings.Split(strings.Trim(repoPath, "/"), "/")
+	if len(folderPath) > MaxFolderDepth || !folderPathValid(folderPath) {
+		return "", false
+	}
+	for _, name := range folderPath {
+		if isValidType(name) {
+			return "", false
+		}
+	}
+	fsPath, err := join(s.Path, folderPath...)
+	return fsPath, err == nil
+}
+
+// isRepo returns true if dir contains a restic repository.
+func isRepo(dir string) bool {
+	fi, err := os.Stat(filepath.Join(dir, "config"))
+	return err == nil && fi.Mode().IsRegular()
+}
+
+// withinRepo returns true if a parent directory of path up to root contains a
+// repository. Such repositories are not found by walkRepos.
+func withinRepo(root, path string) bool {
+	root = filepath.Clean(root)
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		if isRepo(dir) {
+			return true
+		}
+		if dir == root || dir == filepath.Dir(dir) {
+			return false
+		}
+	}
+}
+
+// walkRepos calls fn for each repository below root, up to MaxFolderDepth.
+// repoPath is the path of the repository as used in URLs.
+func walkRepos(root string, fn func(fsPath, repoPath string) error) error {
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		if rel != "." && (strings.HasPrefix(d.Name(), ".") || strings.Count(rel, string(filepath.Separator)) >= MaxFolderDepth) {
+			return filepath.SkipDir
+		}
+		if !isRepo(p) {
+			return nil
+		}
+		if err := fn(p, "/"+strings.TrimPrefix(filepath.ToSlash(rel), ".")); err != nil {
+			return err
+		}
+		return filepath.SkipDir
+	})
+}
+
+func (s *Server) adminListRepos(w http.ResponseWriter, _ *http.Request) {
+	repos := []AdminRepo{}
+	err := walkRepos(s.Path, func(fsPath, repoPath string) error {
+		size, err := quota.DirSize(fsPath)
+		if err != nil {
+			return err
+		}
+		repos = append(repos, AdminRepo{Path: repoPath, Size: size, Frozen: repo.IsFrozen(fsPath)})
+		return nil
+	})
+	if err != nil {
+		log.Printf("admin: cannot list repositories: %v", err)
+		httpDefaultError(w, http.StatusInternalServerError)
+		return
+	}
+	sendJSON(w, http.StatusOK, repos)
+}
+
+func (s *Server) adminDeleteRepo(w http.ResponseWriter, r *http.Request) {
+	fsPath, ok := s.adminRepoPath(r.PathValue("path"))
+	if !ok || !isRepo(fsPath) {
+		httpDefaultError(w, http.StatusNotFound)
+		return
+	}
+
+	holds, err := repo.ListHolds(fsPath)
+	if err != nil {
+		log.Printf("admin: cannot list holds of %s: %v", fsPath, err)
+		httpDefaultError(w, http.StatusInternalServerError)
+		return
+	}
+	if len(holds) > 0 {
+		http.Error(w, "repository contains objects under legal hold", http.StatusLocked)
+		return
+	}
+	if repo.IsFrozen(fsPath) {
+		http.Error(w, "repository is frozen, unfreeze it first", http.StatusLocked)
+		return
+	}
+	if s.adminProtected(r.PathValue("path")) {
+		http.Error(w, "protected repositories cannot be deleted", http.StatusForbidden)
+		return
+	}
+	if s.TrashRetention > 0 {
+		// the repository could not be restored from the trash
+		http.Error(w, "repositories cannot be deleted while the trash is enabled", http.StatusForbidden)
+		return
+	}
+
+	retained, err := repo.HasRetainedFiles(fsPath, s.MinRetention)
+	if err != nil {
+		log.Printf("admin: cannot check retention of %s: %v", fsPath, err)
+		httpDefaultError(w, http.StatusInternalServerError)
+		return
+	}
+	if retained {
+		http.Error(w, "repository contains files younger than the minimum retention", http.StatusForbidden)
+		return
+	}
+
+	size, err := quota.DirSize(fsPath)
+	if err != nil {
+		log.Printf("admin: cannot determine size of %s: %v", fsPath, err)
+		httpDefaultError(w, http.StatusInternalServerError)
+		return
+	}
+	if err := os.RemoveAll(fsPath); err != nil {
+		log.Printf("admin: cannot delete %s: %v", fsPath, err)
+		httpDefaultError(w, http.StatusInternalServerError)
+		return
+	}
+	if s.quotaManager != nil {
+		s.quotaManager.DecUsage(size)
+	}
+	log.Printf("admin: deleted repository %s", fsPath)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) adminRenameRepo(w http.ResponseWriter, r *http.Request) {
+	fsPath, ok := s.adminRepoPath(r.PathValue("path"))
+	if !ok || !isRepo(fsPath) {
+		httpDefaultError(w, http.StatusNotFound)
+		return
+	}
+	if repo.IsFrozen(fsPath) {
+		// the state of the delete guard is bound to the path of the repository
+		http.Error(w, "repository is frozen, unfreeze it first", http.StatusLocked)
+		return
+	}
+	if s.adminProtected(r.PathValue("path")) {
+		// the protection is bound to the path of the repository
+		http.Error(w, "protected repositories cannot be renamed", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		Path string `json:"path"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	newPath, ok := s.adminRepoPath(req.Path)
+	if !ok || newPath == filepath.Clean(s.Path) {
+		http.Error(w, "invalid repository path", http.StatusBadRequest)
+		return
+	}
+	if _, err := os.Lstat(newPath); err == nil {
+		http.Error(w, "repository path already exists", http.StatusConflict)
+		return
+	}
+	if withinRepo(s.Path, newPath) {
+		http.Error(w, "repository path is within another repository", http.StatusConflict)
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(newPath), s.repoDirMode()); err != nil {
+		log.Printf("admin: cannot create %s: %v", filepath.Dir(newPath), err)
+		httpDefaultError(w, http.StatusInternalServerError)
+		return
+	}
+	if err := os.Rename(fsPath, newPath); err != nil {
+		log.Printf("admin: cannot rename %s: %v", fsPath, err)
+		httpDefaultError(w, http.StatusInternalServerError)
+		return
+	}
+	log.Printf("admin: renamed repository %s to %s", fsPath, newPath)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) adminReload(w http.ResponseWriter, _ *http.Request) {
+	if err := s.htpasswdFile.Reload(); err != nil {
+		log.Printf("admin: cannot reload %s: %v", s.HtpasswdPath, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) adminQuota(w http.ResponseWriter, _ *http.Request) {
+	if s.quotaManager == nil {
+		http.Error(w, "quota is not enabled", http.StatusNotFound)
+		return
+	}
+	sendJSON(w, http.StatusOK, AdminQuota{
+		MaxRepoSize:    s.quotaManager.MaxRepoSize(),
+		SpaceUsed:      s.quotaManager.SpaceUsed(),
+		SpaceRemaining: s.quotaManager.SpaceRemaining(),
+	})
+}
@@ -0,0 +1,185 @@
+package restserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdminAPI(t *testing.T) {
+	dir := t.TempDir()
+	htpasswd := filepath.Join(dir, ".htpasswd")
+	pwd := "$2y$05$z/OEmNQamd6m6LSegUErh.r/Owk9Xwmc5lxDheIuHY2Z7XiS6FtJm"
+	if err := os.WriteFile(htpasswd, []byte("root:"+pwd+":admin\nrestic:"+pwd+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	mux, _, _, tempdir, cleanup := createTestHandler(t, &Server{
+		HtpasswdPath: htpasswd,
+		AdminAPI:     true,
+		MaxRepoSize:  1 << 20,
+	})
+	defer cleanup()
+
+	request := func(user, method, path, body string) *httptest.ResponseRecorder {
+		req := newRequest(t, method, path, strings.NewReader(body))
+		req.SetBasicAuth(user, "test")
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := request("restic", "GET", "/_admin/users", ""); rr.Code != http.StatusForbidden {
+		t.Fatalf("non-admin user: want %v, got %v", http.StatusForbidden, rr.Code)
+	}
+
+	// create a user and a repository for it
+	rr := request("root", "POST", "/_admin/users", `{"username": "alice", "password": "secret", "create_repo": true}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create user: want %v, got %v: %s", http.StatusCreated, rr.Code, rr.Body)
+	}
+	if rr := request("root", "POST", "/_admin/users", `{"username": "alice", "password": "secret"}`); rr.Code != http.StatusConflict {
+		t.Fatalf("create existing user: want %v, got %v", http.StatusConflict, rr.Code)
+	}
+	if rr := request("root", "POST", "/_admin/users", `{"username": "carol", "password": "secret", "attributes": ["a:b"]}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("create user with invalid attribute: want %v, got %v", http.StatusBadRequest, rr.Code)
+	}
+	if rr := request("root", "POST", "/_admin/users", `{"username": "_admin", "password": "secret"}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("create user with reserved name: want %v, got %v", http.StatusBadRequest, rr.Code)
+	}
+
+	req := newRequest(t, "POST", "/alice/?create=true", nil)
+	req.SetBasicAuth("alice", "secret")
+	checkRequest(t, mux.ServeHTTP, req, []wantFunc{wantCode(http.StatusOK)})
+
+	var users []AdminUser
+	rr = request("root", "GET", "/_admin/users", "")
+	if err := json.Unmarshal(rr.Body.Bytes(), &users); err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 3 || users[2].Username != "alice" {
+		t.Errorf("unexpected users %v", users)
+	}
+
+	if err := os.WriteFile(filepath.Join(tempdir, "alice", "config"), []byte("config"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var repos []AdminRepo
+	rr = request("root", "GET", "/_admin/repos", "")
+	if err := json.Unmarshal(rr.Body.Bytes(), &repos); err != nil {
+		t.Fatal(err)
+	}
+	if len(repos) != 1 || repos[0].Path != "/alice" || repos[0].Size == 0 {
+		t.Errorf("unexpected repos %v", repos)
+	}
+
+	// repositories cannot be moved into another repository
+	if err := os.MkdirAll(filepath.Join(tempdir, "other"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tempdir, "other", "config"), []byte("config"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if rr := request("root", "PATCH", "/_admin/repos/alice", `{"path": "other/alice"}`); rr.Code != http.StatusConflict {
+		t.Fatalf("rename into repository: want %v, got %v", http.StatusConflict, rr.Code)
+	}
+	if err := os.RemoveAll(filepath.Join(tempdir, "other")); err != nil {
+		t.Fatal(err)
+	}
+
+	// rename and delete the repository
+	if rr := request("root", "PATCH", "/_admin/repos/alice", `{"path": "bob/backup"}`); rr.Code != http.StatusNoContent {
+		t.Fatalf("rename: want %v, got %v: %s", http.StatusNoContent, rr.Code, rr.Body)
+	}
+	if rr := request("root", "DELETE", "/_admin/repos/alice", ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("delete renamed: want %v, got %v", http.StatusNotFound, rr.Code)
+	}
+	if rr := request("root", "DELETE", "/_admin/repos/../bob/backup", ""); rr.Code == http.StatusNoContent {
+		t.Fatal("delete with invalid path succeeded")
+	}
+	if rr := request("root", "DELETE", "/_admin/repos/bob/backup", ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("delete: want %v, got %v", http.StatusNoContent, rr.Code)
+	}
+	if _, err := os.Stat(filepath.Join(tempdir, "bob", "backup")); !os.IsNotExist(err) {
+		t.Errorf("repository was not deleted: %v", err)
+	}
+
+	var q AdminQuota
+	rr = request("root", "GET", "/_admin/quota", "")
+	if err := json.Unmarshal(rr.Body.Bytes(), &q); err != nil {
+		t.Fatal(err)
+	}
+	if q.MaxRepoSize != 1<<20 || q.SpaceUsed+q.SpaceRemaining != q.MaxRepoSize {
+		t.Errorf("unexpected quota %+v", q)
+	}
+
+	if rr := request("root", "POST", "/_admin/reload", ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("reload: want %v, got %v", http.StatusNoContent, rr.Code)
+	}
+}
+
+// adminTestHandler returns a handler with the admin API enabled for the user
+// "root", the regular user "restic" and a repository at "/alice", and a
+// function to send requests as "root".
+func adminTestHandler(t *testing.T, conf *Server) (http.Handler, string, func(method, path, body string) *httptest.ResponseRecorder) {
+	dir := t.TempDir()
+	conf.HtpasswdPath = filepath.Join(dir, ".htpasswd")
+	conf.AdminAPI = true
+	pwd := "$2y$05$z/OEmNQamd6m6LSegUErh.r/Owk9Xwmc5lxDheIuHY2Z7XiS6FtJm"
+	if err := os.WriteFile(conf.HtpasswdPath, []byte("root:"+pwd+":admin\nrestic:"+pwd+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	mux, _, _, tempdir, cleanup := createTestHandler(t, conf)
+	t.Cleanup(cleanup)
+	if err := os.MkdirAll(filepath.Join(tempdir, "alice"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tempdir, "alice", "config"), []byte("config"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return mux, tempdir, func(method, path, body string) *httptest.ResponseRecorder {
+		req := newRequest(t, method, path, strings.NewReader(body))
+		req.SetBasicAuth("root", "test")
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr
+	}
+}
+
+func TestAdminDeleteRepoTrash(t *testing.T) {
+	_, tempdir, request := adminTestHandler(t, &Server{TrashRetention: time.Hour})
+
+	if rr := request("DELETE", "/_admin/repos/alice", ""); rr.Code != http.StatusForbidden {
+		t.Fatalf("delete with trash: want %v, got %v", http.StatusForbidden, rr.Code)
+	}
+	if !isRepo(filepath.Join(tempdir, "alice")) {
+		t.Error("repository was deleted")
+	}
+}
+
+func TestAdminCreateRepoMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not supported on Windows")
+	}
+	_, tempdir, request := adminTestHandler(t, &Server{GroupAccessibleRepos: true})
+
+	rr := request("POST", "/_admin/users", `{"username": "bob", "password": "secret", "create_repo": true}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create user: want %v, got %v: %s", http.StatusCreated, rr.Code, rr.Body)
+	}
+	fi, err := os.Stat(filepath.Join(tempdir, "bob"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := fi.Mode().Perm(); mode&0070 == 0 {
+		t.Errorf("repository directory is not group accessible: %v", mode)
+	}
+}
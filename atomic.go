@@ -0,0 +1,73 @@
+package restserver
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// writeFileAtomic replaces the file at path with data. The data is written to
+// a temporary file in the same directory first, which is then renamed, so that
+// readers either see the old or the new content. The permissions of an
+// existing file are preserved, new files are created using perm.
+//
+// A file which is a mount point, for example a file bind-mounted into a
+// container, cannot be replaced. It is overwritten in place instead, which is
+// not atomic.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	if stat, err := os.Stat(path); err == nil {
+		perm = stat.Mode().Perm()
+	}
+
+	tf, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tf.Write(data); err != nil {
+		_ = tf.Close()
+		_ = os.Remove(tf.Name())
+		return err
+	}
+	if err := tf.Chmod(perm); err != nil {
+		_ = tf.Close()
+		_ = os.Remove(tf.Name())
+		return err
+	}
+	if err := tf.Sync(); err != nil {
+		_ = tf.Close()
+		_ = os.Remove(tf.Name())
+		return err
+	}
+	if err := tf.Close(); err != nil {
+		_ = os.Remove(tf.Name())
+		return err
+	}
+
+	if err := os.Rename(tf.Name(), path); err != nil {
+		_ = os.Remove(tf.Name())
+		if errors.Is(err, syscall.EBUSY) {
+			return overwriteFile(path, data)
+		}
+		return err
+	}
+	return nil
+}
+
+// overwriteFile replaces the content of the existing file at path with data.
+func overwriteFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
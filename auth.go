@@ -0,0 +1,150 @@
+package restserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Authenticator verifies the credentials sent with a request.
+type Authenticator interface {
+	// Authenticate returns the name of the user who sent r. If the request
+	// does not contain valid credentials, false is returned.
+	Authenticate(r *http.Request) (username string, ok bool)
+}
+
+// noAuth accepts all requests without a username.
+type noAuth struct{}
+
+func (noAuth) Authenticate(_ *http.Request) (string, bool) {
+	return "", true
+}
+
+// proxyAuth takes the username from a header set by a reverse proxy.
+type proxyAuth struct {
+	header  string
+	proxies *trustedProxies // if set, the header is only accepted from these addresses
+	debug   bool
+}
+
+func (p proxyAuth) Authenticate(r *http.Request) (string, bool) {
+	if p.proxies != nil && !p.proxies.contains(r) {
+		if p.debug {
+			log.Printf("Ignoring proxy authentication from untrusted address %s", r.RemoteAddr)
+		}
+		return "", false
+	}
+	username := r.Header.Get(p.header)
+	return username, username != ""
+}
+
+// Authenticate checks the HTTP basic auth credentials of r against the
+// htpasswd file.
+func (h *HtpasswdFile) Authenticate(r *http.Request) (string, bool) {
+	username, password, ok := r.BasicAuth()
+	if !ok || !h.Validate(username, password) {
+		return "", false
+	}
+	return username, true
+}
+
+// CommandAuthenticator checks HTTP basic auth credentials by running an
+// external program, similar to qmail's checkpassword. The program receives the
+// username and the password on stdin, each followed by a newline, and must
+// exit with status 0 if the credentials are valid. Any other exit status
+// rejects the credentials. Successful checks are cached for
+// PasswordCacheDuration.
+type CommandAuthenticator struct {
+	Command []string // program and its arguments
+	Timeout time.Duration
+
+	mutex sync.Mutex
+	cache map[string]cacheEntry
+}
+
+// NewCommandAuthenticator returns an authenticator which runs command to
+// check credentials.
+func NewCommandAuthenticator(command []string, timeout time.Duration) (*CommandAuthenticator, error) {
+	if len(command) == 0 {
+		return nil, errors.New("no authentication command given")
+	}
+	if _, err := exec.LookPath(command[0]); err != nil {
+		return nil, err
+	}
+	return &CommandAuthenticator{
+		Command: command,
+		Timeout: timeout,
+		cache:   make(map[string]cacheEntry),
+	}, nil
+}
+
+// Authenticate checks the HTTP basic auth credentials of r.
+func (c *CommandAuthenticator) Authenticate(r *http.Request) (string, bool) {
+	username, password, ok := r.BasicAuth()
+	// the username is passed to the program on a single line
+	if !ok || !ValidUsername(username) || !c.Validate(r.Context(), username, password) {
+		return "", false
+	}
+	return username, true
+}
+
+// Validate returns true if the command accepts password for user.
+func (c *CommandAuthenticator) Validate(ctx context.Context, user string, password string) bool {
+	if user == "" || strings.ContainsAny(user, "\n\x00") || strings.ContainsAny(password, "\n\x00") {
+		return false
+	}
+
+	hash := sha256.New()
+	_, _ = hash.Write([]byte(user))
+	_, _ = hash.Write([]byte(":"))
+	_, _ = hash.Write([]byte(password))
+	verifier := hash.Sum(nil)
+
+	now := time.Now()
+	c.mutex.Lock()
+	entry, ok := c.cache[user]
+	c.mutex.Unlock()
+	if ok && now.Before(entry.expiry) && subtle.ConstantTimeCompare(entry.verifier, verifier) == 1 {
+		return true
+	}
+
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, c.Command[0], c.Command[1:]...)
+	cmd.Stdin = strings.NewReader(user + "\n" + password + "\n")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	// do not wait for children of the command which keep stderr open
+	cmd.WaitDelay = time.Second
+
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			log.Printf("Authentication command rejected %s.", user)
+		} else {
+			log.Printf("Authentication command failed for %s: %v %s", user, err, strings.TrimSpace(stderr.String()))
+		}
+		return false
+	}
+
+	c.mutex.Lock()
+	for name, e := range c.cache {
+		if now.After(e.expiry) {
+			delete(c.cache, name)
+		}
+	}
+	c.cache[user] = cacheEntry{verifier: verifier, expiry: now.Add(PasswordCacheDuration)}
+	c.mutex.Unlock()
+	return true
+}
@@ -0,0 +1,68 @@
+package restserver
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestCommandAuthenticator(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test requires a POSIX shell")
+	}
+
+	dir := t.TempDir()
+	script := filepath.Join(dir, "checkpassword")
+	calls := filepath.Join(dir, "calls")
+	content := "#!/bin/sh\nread user\nread pass\necho \"$user\" >> " + calls + "\n" +
+		"[ \"$user\" = restic ] && [ \"$pass\" = secret ] && exit 0\n" +
+		"[ \"$user\" = slow ] && sleep 5\nexit 1\n"
+	if err := os.WriteFile(script, []byte(content), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	auth, err := NewCommandAuthenticator([]string{script}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		user     string
+		password string
+		want     bool
+	}{
+		{"restic", "secret", true},
+		{"restic", "secret", true}, // cached
+		{"restic", "wrong", false},
+		{"restic", "secret\nrestic", false},
+		{"restic\nrestic", "secret", false}, // invalid username, not passed on
+		{"other", "secret", false},
+		{"slow", "secret", false},
+	}
+	for _, test := range tests {
+		req, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.SetBasicAuth(test.user, test.password)
+		username, ok := auth.Authenticate(req)
+		if ok != test.want || (ok && username != test.user) {
+			t.Errorf("%q/%q: want %v, got %q %v", test.user, test.password, test.want, username, ok)
+		}
+	}
+
+	data, err := os.ReadFile(calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "restic\nrestic\nother\nslow\n"; string(data) != want {
+		t.Errorf("unexpected calls of the command, want %q, got %q", want, data)
+	}
+
+	if _, err := NewCommandAuthenticator([]string{filepath.Join(dir, "missing")}, time.Second); err == nil {
+		t.Error("missing command accepted")
+	}
+}
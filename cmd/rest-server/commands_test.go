@@ -0,0 +1,393 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	restserver "github.com/restic/rest-server"
+	"github.com/restic/rest-server/repo"
+)
+
+// runCommand runs rest-server with args and stdin and returns its output.
+func runCommand(t *testing.T, stdin string, args ...string) (stdout string, stderr string, err error) {
+	t.Helper()
+	app := newRestServerApp()
+	var out, errOut bytes.Buffer
+	app.CmdRoot.SetArgs(args)
+	app.CmdRoot.SetIn(strings.NewReader(stdin))
+	app.CmdRoot.SetOut(&out)
+	app.CmdRoot.SetErr(&errOut)
+	err = app.CmdRoot.Execute()
+	return out.String(), errOut.String(), err
+}
+
+// createTestRepo creates a repository at name below dataPath with a single
+// data file and returns the id of the file.
+func createTestRepo(t *testing.T, dataPath, name string) string {
+	t.Helper()
+	content := []byte("file content " + name)
+	hash := sha256.Sum256(content)
+	id := hex.EncodeToString(hash[:])
+
+	repoPath := filepath.Join(dataPath, name)
+	if err := os.MkdirAll(filepath.Join(repoPath, "data", id[:2]), 0700); err != nil {
+		t.Fatal(err)
+	}
+	for fn, data := range map[string][]byte{
+		"config":                          []byte("config"),
+		filepath.Join("data", id[:2], id): content,
+	} {
+		if err := os.WriteFile(filepath.Join(repoPath, fn), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return id
+}
+
+// deleteFile deletes a file from the repository at repoPath using a handler
+// with opt.
+func deleteFile(t *testing.T, repoPath string, opt repo.Options, urlPath string) {
+	t.Helper()
+	h, err := repo.New(repoPath, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("DELETE", urlPath, nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("DELETE %v: want status %v, got %v", urlPath, http.StatusOK, rr.Code)
+	}
+}
+
+func TestUserCommand(t *testing.T) {
+	dir := t.TempDir()
+	htpasswd := filepath.Join(dir, ".htpasswd")
+
+	if _, _, err := runCommand(t, "secret\n", "user", "add", "--path", dir, "--password-stdin", "--append-only", "--create-repo", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := runCommand(t, "secret\n", "user", "add", "--path", dir, "--password-stdin", "--admin", "root"); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(filepath.Join(dir, "alice")); err != nil || !fi.IsDir() {
+		t.Errorf("repository directory was not created: %v", err)
+	}
+	for _, args := range [][]string{
+		{"user", "add", "--path", dir, "--password-stdin", "alice"},
+		{"user", "add", "--path", dir, "--password-stdin", "../bob"},
+		{"user", "add", "--path", dir, "--password-stdin", "_admin"},
+		{"user", "add", "--path", dir, "--password-stdin", "_user"},
+		{"user", "passwd", "--path", dir, "--password-stdin", "bob"},
+		{"user", "remove", "--path", dir, "bob"},
+	} {
+		if _, _, err := runCommand(t, "secret\n", args...); err == nil {
+			t.Errorf("%v did not fail", args)
+		}
+	}
+	if _, _, err := runCommand(t, "", "user", "add", "--path", dir, "--password-stdin", "bob"); err == nil {
+		t.Error("empty password was accepted")
+	}
+
+	out, _, err := runCommand(t, "", "user", "list", "--htpasswd-file", htpasswd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "alice                append-only\nroot                 admin\n"; out != want {
+		t.Errorf("unexpected user list, want %q, got %q", want, out)
+	}
+
+	if _, _, err := runCommand(t, "changed\n", "user", "passwd", "--path", dir, "--password-stdin", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	htpass, err := restserver.NewHtpasswdFromFile(htpasswd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !htpass.Validate("alice", "changed") || htpass.Validate("alice", "secret") {
+		t.Error("password was not changed")
+	}
+
+	if _, _, err := runCommand(t, "", "user", "remove", "--path", dir, "root"); err != nil {
+		t.Fatal(err)
+	}
+	out, _, err = runCommand(t, "", "user", "list", "--path", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out, "root") {
+		t.Errorf("removed user is still listed: %q", out)
+	}
+}
+
+func TestTokenCommand(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "tokens.json")
+
+	token, stderr, err := runCommand(t, "", "token", "create", "--token-file", fn, "--user", "ci", "--repo", "/ci", "--scope", "append", "--expires", "1h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token = strings.TrimSpace(token)
+	if len(token) != 64 {
+		t.Fatalf("unexpected token %q", token)
+	}
+
+	tokens, err := restserver.ReadTokens(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 1 || tokens[0].Username != "ci" || tokens[0].Scope != "append" || tokens[0].Expires.IsZero() {
+		t.Fatalf("unexpected tokens %+v", tokens)
+	}
+	id := tokens[0].ID()
+	if !strings.Contains(stderr, id) {
+		t.Errorf("token id %v is not reported: %q", id, stderr)
+	}
+
+	for _, args := range [][]string{
+		{"token", "create", "--token-file", fn, "--user", "../ci"},
+		{"token", "create", "--token-file", fn, "--user", "ci", "--scope", "write"},
+		{"token", "revoke", "--token-file", fn, "unknown"},
+	} {
+		if _, _, err := runCommand(t, "", args...); err == nil {
+			t.Errorf("%v did not fail", args)
+		}
+	}
+
+	out, _, err := runCommand(t, "", "token", "list", "--token-file", fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out, id+"  ci") || !strings.Contains(out, "[/ci]") {
+		t.Errorf("unexpected token list %q", out)
+	}
+
+	if _, _, err := runCommand(t, "", "token", "revoke", "--token-file", fn, id); err != nil {
+		t.Fatal(err)
+	}
+	out, _, err = runCommand(t, "", "token", "list", "--token-file", fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "" {
+		t.Errorf("revoked token is still listed: %q", out)
+	}
+}
+
+func TestSignURLCommand(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "key")
+	if err := os.WriteFile(keyFile, []byte(strings.Repeat("k", 32)+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	out, _, err := runCommand(t, "", "sign-url", "--url-signing-key-file", keyFile, "--base-url", "https://backup.example.com/", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefix := "https://backup.example.com" + restserver.SignedURLPrefix + "read/"
+	if !strings.HasPrefix(out, prefix) || !strings.HasSuffix(out, "/alice/\n") {
+		t.Errorf("unexpected signed URL %q", out)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "short"), []byte("short"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{
+		{"sign-url", "--url-signing-key-file", filepath.Join(dir, "short"), "alice"},
+		{"sign-url", "--url-signing-key-file", keyFile, "--expires", "0", "alice"},
+		{"sign-url", "--url-signing-key-file", keyFile, "alice/data"},
+	} {
+		if _, _, err := runCommand(t, "", args...); err == nil {
+			t.Errorf("%v did not fail", args)
+		}
+	}
+}
+
+func TestTrashCommand(t *testing.T) {
+	dir := t.TempDir()
+	id := createTestRepo(t, dir, "alice")
+	dataFile := filepath.Join(dir, "alice", "data", id[:2], id)
+	deleteFile(t, filepath.Join(dir, "alice"), repo.Options{Trash: true, Username: "alice"}, "/data/"+id)
+	if _, err := os.Stat(dataFile); err == nil {
+		t.Fatal("file was not deleted")
+	}
+
+	out, _, err := runCommand(t, "", "trash", "list", "--path", dir, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := strings.Fields(out)
+	if len(fields) != 5 || fields[2] != "alice" || fields[4] != "data/"+id[:2]+"/"+id {
+		t.Fatalf("unexpected trash list %q", out)
+	}
+
+	if _, _, err := runCommand(t, "", "trash", "restore", "--path", dir, "alice", "unknown"); err == nil {
+		t.Error("restoring an unknown file did not fail")
+	}
+	if _, _, err := runCommand(t, "", "trash", "list", "--path", dir, "../alice"); err == nil {
+		t.Error("invalid repository path was accepted")
+	}
+	if _, _, err := runCommand(t, "", "trash", "restore", "--path", dir, "alice", fields[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dataFile); err != nil {
+		t.Errorf("file was not restored: %v", err)
+	}
+}
+
+func TestHoldCommand(t *testing.T) {
+	dir := t.TempDir()
+	id := createTestRepo(t, dir, "alice")
+
+	if _, _, err := runCommand(t, "", "hold", "add", "--path", dir, "--reason", "case 42", "alice", "data", id); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := runCommand(t, "", "hold", "add", "--path", dir, "alice", "data", strings.Repeat("0", 64)); err == nil {
+		t.Error("hold on a missing file was accepted")
+	}
+
+	out, _, err := runCommand(t, "", "hold", "list", "--path", dir, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out, "data/"+id+"  ") || !strings.HasSuffix(out, "case 42\n") {
+		t.Errorf("unexpected hold list %q", out)
+	}
+
+	if _, _, err := runCommand(t, "", "hold", "release", "--path", dir, "alice", "data", id); err != nil {
+		t.Fatal(err)
+	}
+	out, _, err = runCommand(t, "", "hold", "list", "--path", dir, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "" {
+		t.Errorf("released hold is still listed: %q", out)
+	}
+	if _, _, err := runCommand(t, "", "hold", "release", "--path", dir, "alice", "data", id); err == nil {
+		t.Error("releasing a missing hold did not fail")
+	}
+}
+
+func TestPendingCommand(t *testing.T) {
+	dir := t.TempDir()
+	repoPath := filepath.Join(dir, "alice")
+	for _, name := range []string{"alice", "bob"} {
+		createTestRepo(t, dir, name)
+	}
+	var ids []string
+	for i := 0; i < 3; i++ {
+		content := []byte{byte(i)}
+		hash := sha256.Sum256(content)
+		id := hex.EncodeToString(hash[:])
+		if err := os.MkdirAll(filepath.Join(repoPath, "data", id[:2]), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(repoPath, "data", id[:2], id), content, 0600); err != nil {
+			t.Fatal(err)
+		}
+		deleteFile(t, repoPath, repo.Options{Protected: true, Username: "alice"}, "/data/"+id)
+		ids = append(ids, id)
+	}
+
+	entries, err := repo.ListPending(repoPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("want 3 pending deletions, got %v", len(entries))
+	}
+	out, _, err := runCommand(t, "", "pending", "list", "--path", dir, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(out, "\n"); n != 3 {
+		t.Errorf("want 3 pending deletions, got %q", out)
+	}
+
+	if _, _, err := runCommand(t, "", "pending", "approve", "--path", dir, "alice", entries[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := runCommand(t, "", "pending", "reject", "--path", dir, "alice", entries[1].ID); err != nil {
+		t.Fatal(err)
+	}
+	restored := filepath.Join(repoPath, filepath.FromSlash(entries[1].Path))
+	if _, err := os.Stat(restored); err != nil {
+		t.Errorf("rejected deletion was not restored: %v", err)
+	}
+	// without ids, all remaining deletions are handled
+	if _, _, err := runCommand(t, "", "pending", "reject", "--path", dir, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if entries, err := repo.ListPending(repoPath); err != nil || len(entries) != 0 {
+		t.Errorf("want no pending deletions, got %v, %v", entries, err)
+	}
+	if _, _, err := runCommand(t, "", "pending", "approve", "--path", dir, "alice", "unknown"); err == nil {
+		t.Error("approving an unknown deletion did not fail")
+	}
+}
+
+func TestUnfreezeCommand(t *testing.T) {
+	dir := t.TempDir()
+	createTestRepo(t, dir, "alice")
+	repoPath := filepath.Join(dir, "alice")
+
+	if _, _, err := runCommand(t, "", "unfreeze", "--path", dir, "alice"); err == nil {
+		t.Error("unfreezing a repository which is not frozen did not fail")
+	}
+	if err := os.WriteFile(filepath.Join(repoPath, repo.FrozenFile), []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if !repo.IsFrozen(repoPath) {
+		t.Fatal("repository is not frozen")
+	}
+	if _, _, err := runCommand(t, "", "unfreeze", "--path", dir, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if repo.IsFrozen(repoPath) {
+		t.Error("repository is still frozen")
+	}
+}
+
+func TestScrubCommand(t *testing.T) {
+	dir := t.TempDir()
+	createTestRepo(t, dir, "alice")
+	id := createTestRepo(t, dir, "bob")
+
+	stdout, stderr, err := runCommand(t, "", "scrub", "--path", dir)
+	if err != nil {
+		t.Fatalf("%v: %s", err, stderr)
+	}
+	if stdout != "" || !strings.Contains(stderr, "alice: checked 1 files") || !strings.Contains(stderr, "bob: checked 1 files") {
+		t.Errorf("unexpected output %q %q", stdout, stderr)
+	}
+
+	// corrupt the data file of bob
+	dataFile := filepath.Join(dir, "bob", "data", id[:2], id)
+	if err := os.WriteFile(dataFile, []byte("corrupt"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := runCommand(t, "", "scrub", "--path", dir, "alice"); err != nil {
+		t.Errorf("scrubbing an intact repository failed: %v", err)
+	}
+	stdout, _, err = runCommand(t, "", "scrub", "--path", dir, "--quarantine", "bob")
+	if err == nil {
+		t.Fatal("corrupt file was not reported as error")
+	}
+	if want := "bob/data/" + id[:2] + "/" + id + ": corrupt\n"; stdout != want {
+		t.Errorf("want output %q, got %q", want, stdout)
+	}
+	if _, err := os.Stat(dataFile); err == nil {
+		t.Error("corrupt file was not moved to the quarantine")
+	}
+	if entries, err := repo.ListQuarantine(filepath.Join(dir, "bob")); err != nil || len(entries) != 1 {
+		t.Errorf("want one file in the quarantine, got %v, %v", entries, err)
+	}
+}
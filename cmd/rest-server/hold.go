@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+
+	"github.com/restic/rest-server/repo"
+	"github.com/spf13/cobra"
+)
+
+// newHoldCommand returns the "hold" command with its subcommands for managing
+// legal holds on objects in a repository.
+func newHoldCommand() *cobra.Command {
+	var dataPaths []string
+
+	cmd := &cobra.Command{
+		Use:   "hold",
+		Short: "Manage legal holds which prevent objects from being deleted",
+		Long: `Manage legal holds which prevent objects from being deleted.
+
+The command modifies the data directory directly and must only be used while
+the server is stopped, as a running server does not notice the changes, for
+example to the quota usage. Use the admin API to manage a running server.`,
+	}
+	cmd.PersistentFlags().StringArrayVar(&dataPaths, "path", []string{filepath.Join(os.TempDir(), "restic")}, "data directory, repeat for all directories used by the server")
+
+	list := &cobra.Command{
+		Use:   "list <repository path>",
+		Short: "List the legal holds in a repository",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, err := repoDir(dataPaths[0], args[0])
+			if err != nil {
+				return err
+			}
+			holds, err := repo.ListHolds(path)
+			if err != nil {
+				return err
+			}
+			for _, h := range holds {
+				fmt.Fprintf(cmd.OutOrStdout(), "%s/%s  %s  %-16s %s\n", h.Type, h.ID, h.Created.Local().Format(time.RFC3339), h.User, h.Reason)
+			}
+			return nil
+		},
+	}
+
+	var reason string
+	add := &cobra.Command{
+		Use:   "add <repository path> <type> <id>...",
+		Short: "Place legal holds on objects",
+		Args:  cobra.MinimumNArgs(3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, err := repoDir(dataPaths[0], args[0])
+			if err != nil {
+				return err
+			}
+			var username string
+			if u, err := user.Current(); err == nil {
+				username = u.Username
+			}
+			// objects may be stored in any of the data directories
+			var storage repo.Storage
+			if len(dataPaths) > 1 {
+				storage = &repo.JBODStorage{Root: dataPaths[0], DataDirs: dataPaths[1:]}
+			}
+			for _, id := range args[2:] {
+				hold := repo.Hold{Type: args[1], ID: id, Reason: reason, User: username, Created: time.Now().UTC()}
+				if _, err := repo.PlaceHold(storage, path, hold); err != nil {
+					return fmt.Errorf("cannot place hold on %s/%s: %w", args[1], id, err)
+				}
+				fmt.Fprintf(cmd.ErrOrStderr(), "placed hold on %s/%s\n", args[1], id)
+			}
+			return nil
+		},
+	}
+	add.Flags().StringVar(&reason, "reason", "", "reason for the hold, e.g. a case number")
+
+	release := &cobra.Command{
+		Use:   "release <repository path> <type> <id>...",
+		Short: "Release legal holds on objects",
+		Args:  cobra.MinimumNArgs(3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, err := repoDir(dataPaths[0], args[0])
+			if err != nil {
+				return err
+			}
+			for _, id := range args[2:] {
+				if _, err := repo.ReleaseHold(path, args[1], id); err != nil {
+					return fmt.Errorf("cannot release hold on %s/%s: %w", args[1], id, err)
+				}
+				fmt.Fprintf(cmd.ErrOrStderr(), "released hold on %s/%s\n", args[1], id)
+			}
+			return nil
+		},
+	}
+
+	cmd.AddCommand(list, add, release)
+	return cmd
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"log"
@@ -15,6 +16,7 @@ import (
 	"runtime/pprof"
 	"sync"
 	"syscall"
+	"time"
 
 	restserver "github.com/restic/rest-server"
 	"github.com/spf13/cobra"
@@ -24,6 +26,7 @@ type restServerApp struct {
 	CmdRoot    *cobra.Command
 	Server     restserver.Server
 	CPUProfile string
+	Paths      []string
 
 	listenerAddressMu sync.Mutex
 	listenerAddress   net.Addr // set after startup
@@ -46,12 +49,20 @@ func newRestServerApp() *restServerApp {
 			Version: fmt.Sprintf("rest-server %s compiled with %v on %v/%v\n", version, runtime.Version(), runtime.GOOS, runtime.GOARCH),
 		},
 		Server: restserver.Server{
-			Path:      filepath.Join(os.TempDir(), "restic"),
-			Listen:    ":8000",
-			TLSMinVer: "1.2",
+			Path:               filepath.Join(os.TempDir(), "restic"),
+			Listen:             ":8000",
+			TLSMinVer:          "1.2",
+			TLSClientUsername:  "cn",
+			JWTUsernameClaim:   "sub",
+			AuthFailureWindow:  10 * time.Minute,
+			AuthLockout:        15 * time.Minute,
+			AuthCommandTimeout: 10 * time.Second,
+			MinPasswordLength:  restserver.DefaultMinPasswordLength,
+			DeleteGuardWindow:  time.Hour,
 		},
 	}
 	rv.CmdRoot.RunE = rv.runRoot
+	rv.CmdRoot.AddCommand(newTokenCommand(), newUserCommand(), newSignURLCommand(), newTrashCommand(), newHoldCommand(), newPendingCommand(), newUnfreezeCommand(), newScrubCommand())
 	flags := rv.CmdRoot.Flags()
 
 	flags.StringVar(&rv.CPUProfile, "cpu-profile", rv.CPUProfile, "write CPU profile to file")
@@ -59,20 +70,56 @@ func newRestServerApp() *restServerApp {
 	flags.StringVar(&rv.Server.Listen, "listen", rv.Server.Listen, "listen address")
 	flags.StringVar(&rv.Server.Log, "log", rv.Server.Log, "write HTTP requests in the combined log format to the specified `filename` (use \"-\" for logging to stdout)")
 	flags.Int64Var(&rv.Server.MaxRepoSize, "max-size", rv.Server.MaxRepoSize, "the maximum size of the repository in bytes")
-	flags.StringVar(&rv.Server.Path, "path", rv.Server.Path, "data directory")
+	flags.StringArrayVar(&rv.Paths, "path", []string{rv.Server.Path}, "data directory, repeat to spread the data files of repositories across several directories")
+	flags.BoolVar(&rv.Server.Memory, "memory", rv.Server.Memory, "keep all repositories in memory instead of the data directory, they are lost when the server exits")
+	flags.Int64Var(&rv.Server.MemoryMaxBytes, "memory-max-bytes", rv.Server.MemoryMaxBytes, "the maximum size of all repositories kept in memory in bytes")
+	flags.BoolVar(&rv.Server.VerifyRead, "verify-read", rv.Server.VerifyRead, "verify the hash of files read completely by clients and abort the transfer if they are corrupt, ranged reads are not verified")
+	flags.StringVar(&rv.Server.MirrorPath, "mirror-path", rv.Server.MirrorPath, "data directory of a mirror used to repair corrupt files found by --verify-read, after the transfer which found them failed")
 	flags.BoolVar(&rv.Server.TLS, "tls", rv.Server.TLS, "turn on TLS support")
 	flags.StringVar(&rv.Server.TLSCert, "tls-cert", rv.Server.TLSCert, "TLS certificate path")
 	flags.StringVar(&rv.Server.TLSKey, "tls-key", rv.Server.TLSKey, "TLS key path")
 	flags.StringVar(&rv.Server.TLSMinVer, "tls-min-ver", rv.Server.TLSMinVer, "TLS min version, one of (1.2|1.3)")
+	flags.StringVar(&rv.Server.TLSClientCA, "tls-client-ca", rv.Server.TLSClientCA, "authenticate clients using certificates signed by the CA in this file")
+	flags.StringVar(&rv.Server.TLSClientUsername, "tls-client-username", rv.Server.TLSClientUsername, "certificate field used as username for client certificates, one of (cn|dns|email)")
 	flags.BoolVar(&rv.Server.NoAuth, "no-auth", rv.Server.NoAuth, "disable authentication")
+	flags.StringVar(&rv.Server.AuthCommand, "auth-command", rv.Server.AuthCommand, "check passwords by running this program with the username and password on stdin instead of using the .htpasswd file")
+	flags.DurationVar(&rv.Server.AuthCommandTimeout, "auth-command-timeout", rv.Server.AuthCommandTimeout, "maximum run time of the authentication command")
 	flags.StringVar(&rv.Server.HtpasswdPath, "htpasswd-file", rv.Server.HtpasswdPath, "location of .htpasswd file (default: \"<data directory>/.htpasswd)\"")
+	flags.BoolVar(&rv.Server.HtpasswdUpgradeSHA, "htpasswd-upgrade-sha", rv.Server.HtpasswdUpgradeSHA, "replace insecure {SHA} password hashes with bcrypt when users log in")
+	flags.BoolVar(&rv.Server.HtpasswdRejectSHA, "htpasswd-reject-sha", rv.Server.HtpasswdRejectSHA, "refuse logins of users with insecure {SHA} password hashes")
+	flags.StringVar(&rv.Server.URLSigningKeyPath, "url-signing-key-file", rv.Server.URLSigningKeyPath, "accept signed URLs for read-only access created with this key")
+	flags.StringVar(&rv.Server.TokenPath, "token-file", rv.Server.TokenPath, "location of the file containing API tokens")
+	flags.StringVar(&rv.Server.JWKSPath, "jwt-jwks-file", rv.Server.JWKSPath, "accept JSON Web Tokens signed by the keys in this JWKS file")
+	flags.StringVar(&rv.Server.JWTIssuer, "jwt-issuer", rv.Server.JWTIssuer, "required issuer (iss claim) of JSON Web Tokens")
+	flags.StringVar(&rv.Server.JWTAudience, "jwt-audience", rv.Server.JWTAudience, "required audience (aud claim) of JSON Web Tokens")
+	flags.StringVar(&rv.Server.JWTUsernameClaim, "jwt-username-claim", rv.Server.JWTUsernameClaim, "JSON Web Token claim containing the username")
+	flags.StringVar(&rv.Server.JWTReposClaim, "jwt-repos-claim", rv.Server.JWTReposClaim, "JSON Web Token claim listing the repositories a user may access")
+	flags.StringVar(&rv.Server.GroupPath, "group-file", rv.Server.GroupPath, "location of the group file listing the members of groups")
+	flags.StringVar(&rv.Server.ACLPath, "acl-file", rv.Server.ACLPath, "location of the file granting users access to repositories")
 	flags.StringVar(&rv.Server.ProxyAuthUsername, "proxy-auth-username", rv.Server.ProxyAuthUsername, "specifies the HTTP header containing the username for proxy-based authentication")
+	flags.IntVar(&rv.Server.MaxAuthFailuresIP, "max-auth-failures-ip", rv.Server.MaxAuthFailuresIP, "lock out remote IPs after this many failed authentication attempts (0 to disable)")
+	flags.IntVar(&rv.Server.MaxAuthFailuresUser, "max-auth-failures-user", rv.Server.MaxAuthFailuresUser, "lock out users after this many failed authentication attempts (0 to disable)")
+	flags.DurationVar(&rv.Server.AuthFailureWindow, "auth-failure-window", rv.Server.AuthFailureWindow, "time window in which failed authentication attempts are counted")
+	flags.DurationVar(&rv.Server.AuthLockout, "auth-lockout", rv.Server.AuthLockout, "duration of a lockout after too many failed authentication attempts")
+	flags.StringSliceVar(&rv.Server.ProtectedRepos, "protected-repos", rv.Server.ProtectedRepos, "repositories in which deleting the config and data, index, keys and snapshot files must be approved")
+	flags.StringSliceVar(&rv.Server.ProxyAuthTrusted, "proxy-auth-trusted-cidrs", rv.Server.ProxyAuthTrusted, "only accept the proxy authentication header from these networks or unix:<socket> listeners, and take the client address from X-Forwarded-For for requests received from them")
 	flags.BoolVar(&rv.Server.NoVerifyUpload, "no-verify-upload", rv.Server.NoVerifyUpload,
 		"do not verify the integrity of uploaded data. DO NOT enable unless the rest-server runs on a very low-power device")
 	flags.BoolVar(&rv.Server.AppendOnly, "append-only", rv.Server.AppendOnly, "enable append only mode")
+	flags.DurationVar(&rv.Server.TrashRetention, "trash-retention", rv.Server.TrashRetention, "move deleted files to the trash of the repository and purge them after this duration (0 to delete immediately)")
+	flags.DurationVar(&rv.Server.MinRetention, "min-retention", rv.Server.MinRetention, "refuse to delete files except locks which are younger than this duration")
+	flags.DurationVar(&rv.Server.DeleteGuardWindow, "delete-guard-window", rv.Server.DeleteGuardWindow, "time window over which deletions are summed up by the delete guard")
+	flags.Float64Var(&rv.Server.DeleteGuardSnapshots, "delete-guard-snapshots", rv.Server.DeleteGuardSnapshots, "freeze a repository if more than this fraction of its snapshots is deleted within the delete guard window (0 to disable)")
+	flags.Float64Var(&rv.Server.DeleteGuardData, "delete-guard-data", rv.Server.DeleteGuardData, "freeze a repository if more than this fraction of its data is deleted within the delete guard window (0 to disable)")
+	flags.StringVar(&rv.Server.DeleteGuardWebhook, "delete-guard-webhook", rv.Server.DeleteGuardWebhook, "URL to POST a JSON notification to when a repository is frozen")
+	flags.DurationVar(&rv.Server.ScrubInterval, "scrub-interval", rv.Server.ScrubInterval, "check the integrity of all repositories in the background, pausing this duration between runs (0 to disable)")
+	flags.Int64Var(&rv.Server.ScrubRate, "scrub-rate", rv.Server.ScrubRate, "maximum number of bytes per second read by the background integrity check (0 for no limit)")
 	flags.BoolVar(&rv.Server.PrivateRepos, "private-repos", rv.Server.PrivateRepos, "users can only access their private repo")
 	flags.BoolVar(&rv.Server.Prometheus, "prometheus", rv.Server.Prometheus, "enable Prometheus metrics")
 	flags.BoolVar(&rv.Server.PrometheusNoAuth, "prometheus-no-auth", rv.Server.PrometheusNoAuth, "disable auth for Prometheus /metrics endpoint")
+	flags.BoolVar(&rv.Server.PasswordChange, "password-change", rv.Server.PasswordChange, "allow users to change their password in the .htpasswd file at /_user/password")
+	flags.IntVar(&rv.Server.MinPasswordLength, "min-password-length", rv.Server.MinPasswordLength, "minimum length of passwords set by users")
+	flags.BoolVar(&rv.Server.AdminAPI, "admin-api", rv.Server.AdminAPI, "enable the admin API at /_admin/ for users with the admin attribute")
 	flags.BoolVar(&rv.Server.GroupAccessibleRepos, "group-accessible-repos", rv.Server.GroupAccessibleRepos, "let filesystem group be able to access repo files")
 
 	return rv
@@ -82,7 +129,7 @@ var version = "0.14.0-dev"
 
 func (app *restServerApp) tlsSettings() (bool, string, string, error) {
 	var key, cert string
-	if !app.Server.TLS && (app.Server.TLSKey != "" || app.Server.TLSCert != "") {
+	if !app.Server.TLS && (app.Server.TLSKey != "" || app.Server.TLSCert != "" || app.Server.TLSClientCA != "") {
 		return false, "", "", errors.New("requires enabled TLS")
 	} else if !app.Server.TLS {
 		return false, "", "", nil
@@ -111,7 +158,19 @@ func (app *restServerApp) ListenerAddress() net.Addr {
 func (app *restServerApp) runRoot(_ *cobra.Command, _ []string) error {
 	log.SetFlags(0)
 
-	log.Printf("Data directory: %s", app.Server.Path)
+	if len(app.Paths) > 0 {
+		app.Server.Path = app.Paths[0]
+		app.Server.DataPaths = app.Paths[1:]
+	}
+
+	if app.Server.Memory {
+		log.Println("Storing repositories in memory, they are lost when the server exits")
+	} else {
+		log.Printf("Data directory: %s", app.Server.Path)
+		for _, dir := range app.Server.DataPaths {
+			log.Printf("Additional data directory: %s", dir)
+		}
+	}
 
 	if app.CPUProfile != "" {
 		f, err := os.Create(app.CPUProfile)
@@ -158,6 +217,30 @@ func (app *restServerApp) runRoot(_ *cobra.Command, _ []string) error {
 		log.Println("Private repositories disabled")
 	}
 
+	if app.Server.ACLPath != "" && !app.Server.NoAuth {
+		log.Println("Access control list enabled")
+	}
+
+	if app.Server.AdminAPI {
+		log.Println("Admin API enabled")
+	}
+
+	if app.Server.PasswordChange {
+		log.Println("Password change enabled")
+	}
+
+	if app.Server.VerifyRead {
+		log.Println("Verify on read enabled")
+	}
+
+	if app.Server.ScrubInterval > 0 {
+		log.Printf("Background scrubbing enabled, interval %v", app.Server.ScrubInterval)
+	}
+
+	if app.Server.DeleteGuardSnapshots > 0 || app.Server.DeleteGuardData > 0 {
+		log.Printf("Delete guard enabled, window %v", app.Server.DeleteGuardWindow)
+	}
+
 	if app.Server.GroupAccessibleRepos {
 		log.Println("Group accessible repos enabled")
 	} else {
@@ -199,6 +282,20 @@ func (app *restServerApp) runRoot(_ *cobra.Command, _ []string) error {
 		return fmt.Errorf("Unsupported TLS min version: %s. Allowed versions are 1.2 or 1.3", app.Server.TLSMinVer)
 	}
 
+	if app.Server.TLSClientCA != "" {
+		pem, err := os.ReadFile(app.Server.TLSClientCA)
+		if err != nil {
+			return err
+		}
+		tlscfg.ClientCAs = x509.NewCertPool()
+		if !tlscfg.ClientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", app.Server.TLSClientCA)
+		}
+		// clients without a certificate can still use other authentication methods
+		tlscfg.ClientAuth = tls.VerifyClientCertIfGiven
+		log.Printf("Client certificate authentication enabled, CA %s", app.Server.TLSClientCA)
+	}
+
 	srv := &http.Server{
 		Handler:   handler,
 		TLSConfig: tlscfg,
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+
+	"github.com/restic/rest-server/repo"
+	"github.com/spf13/cobra"
+)
+
+// newPendingCommand returns the "pending" command with its subcommands for
+// approving or rejecting deletions in protected repositories.
+func newPendingCommand() *cobra.Command {
+	var dataPath string
+
+	cmd := &cobra.Command{
+		Use:   "pending",
+		Short: "Approve or reject deletions in repositories set with --protected-repos",
+		Long: `Approve or reject deletions in repositories set with --protected-repos.
+
+The command modifies the data directory directly and must only be used while
+the server is stopped, as a running server does not notice the changes, for
+example to the quota usage. Use the admin API to manage a running server.`,
+	}
+	cmd.PersistentFlags().StringVar(&dataPath, "path", filepath.Join(os.TempDir(), "restic"), "data directory")
+
+	// pendingIDs returns the given ids, or the ids of all pending deletions
+	// if there are none.
+	pendingIDs := func(path string, ids []string) ([]string, error) {
+		if len(ids) > 0 {
+			return ids, nil
+		}
+		entries, err := repo.ListPending(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			ids = append(ids, e.ID)
+		}
+		return ids, nil
+	}
+
+	list := &cobra.Command{
+		Use:   "list <repository path>",
+		Short: "List the files awaiting approval for deletion",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, err := repoDir(dataPath, args[0])
+			if err != nil {
+				return err
+			}
+			entries, err := repo.ListPending(path)
+			if err != nil {
+				return err
+			}
+			for _, e := range entries {
+				fmt.Fprintf(cmd.OutOrStdout(), "%s  %s  %-16s %10d  %s\n", e.ID, e.Deleted.Local().Format(time.RFC3339), e.User, e.Size, e.Path)
+			}
+			return nil
+		},
+	}
+
+	approve := &cobra.Command{
+		Use:   "approve <repository path> [id]...",
+		Short: "Permanently delete files, all pending files if no id is given",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// the system user is only compared with the name of the user who
+			// requested the deletion, the check is advisory
+			u, err := user.Current()
+			if err != nil {
+				return fmt.Errorf("cannot determine the approving user: %w", err)
+			}
+			approver := u.Username
+			path, err := repoDir(dataPath, args[0])
+			if err != nil {
+				return err
+			}
+			ids, err := pendingIDs(path, args[1:])
+			if err != nil {
+				return err
+			}
+			var failed bool
+			for _, id := range ids {
+				if _, err := repo.ApprovePending(path, id, approver); err != nil {
+					if !errors.Is(err, repo.ErrSameApprover) && !errors.Is(err, repo.ErrHeld) {
+						return fmt.Errorf("cannot approve %s: %w", id, err)
+					}
+					fmt.Fprintf(cmd.ErrOrStderr(), "skipped %s: %v\n", id, err)
+					failed = true
+					continue
+				}
+				fmt.Fprintf(cmd.ErrOrStderr(), "deleted %s\n", id)
+			}
+			if failed {
+				return errors.New("some deletions were not approved")
+			}
+			return nil
+		},
+	}
+
+	reject := &cobra.Command{
+		Use:   "reject <repository path> [id]...",
+		Short: "Restore files, all pending files if no id is given",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, err := repoDir(dataPath, args[0])
+			if err != nil {
+				return err
+			}
+			ids, err := pendingIDs(path, args[1:])
+			if err != nil {
+				return err
+			}
+			for _, id := range ids {
+				if _, err := repo.RejectPending(path, id); err != nil {
+					return fmt.Errorf("cannot restore %s: %w", id, err)
+				}
+				fmt.Fprintf(cmd.ErrOrStderr(), "restored %s\n", id)
+			}
+			return nil
+		},
+	}
+
+	cmd.AddCommand(list, approve, reject)
+	return cmd
+}
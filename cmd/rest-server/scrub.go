@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	restserver "github.com/restic/rest-server"
+	"github.com/restic/rest-server/repo"
+	"github.com/spf13/cobra"
+)
+
+// newScrubCommand returns the "scrub" command, which checks the integrity of
+// repositories.
+func newScrubCommand() *cobra.Command {
+	var (
+		dataPath   string
+		opt        repo.ScrubOptions
+		corrupt    int
+		scrubError bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "scrub [repository path]...",
+		Short: "Check that the files in repositories match their hash, all repositories if none is given",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			report := func(repoPath string, res repo.ScrubResult, err error) {
+				for _, fn := range res.Corrupt {
+					fmt.Fprintf(cmd.OutOrStdout(), "%s/%s: corrupt\n", repoPath, fn)
+				}
+				corrupt += len(res.Corrupt)
+				if err != nil {
+					fmt.Fprintf(cmd.ErrOrStderr(), "%s: %v\n", repoPath, err)
+					scrubError = true
+					return
+				}
+				fmt.Fprintf(cmd.ErrOrStderr(), "%s: checked %d files, %d bytes\n", repoPath, res.Files, res.Bytes)
+			}
+
+			if len(args) == 0 {
+				if err := restserver.ScrubRepos(cmd.Context(), dataPath, opt, report); err != nil {
+					return err
+				}
+			}
+			for _, name := range args {
+				path, err := repoDir(dataPath, name)
+				if err != nil {
+					return err
+				}
+				res, err := repo.Scrub(cmd.Context(), path, opt)
+				report(name, res, err)
+			}
+
+			switch {
+			case scrubError:
+				return errors.New("some repositories could not be checked")
+			case corrupt > 0:
+				return fmt.Errorf("found %d corrupt files", corrupt)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&dataPath, "path", filepath.Join(os.TempDir(), "restic"), "data directory")
+	cmd.Flags().Int64Var(&opt.Rate, "rate", 0, "maximum number of bytes read per second (0 for no limit)")
+	cmd.Flags().BoolVar(&opt.Quarantine, "quarantine", false, "move corrupt files except held objects to the quarantine directory of the repository")
+	return cmd
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	restserver "github.com/restic/rest-server"
+	"github.com/spf13/cobra"
+)
+
+// newSignURLCommand returns the "sign-url" command, which prints a signed URL
+// granting temporary read-only access to a repository.
+func newSignURLCommand() *cobra.Command {
+	var (
+		keyPath string
+		baseURL string
+		expires time.Duration
+	)
+
+	cmd := &cobra.Command{
+		Use:   "sign-url <repository path>",
+		Short: "Print a signed URL for temporary read-only access to a repository",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if expires <= 0 {
+				return errors.New("the expiry must be positive")
+			}
+			key, err := restserver.ReadURLSigningKey(keyPath)
+			if err != nil {
+				return err
+			}
+			expiry := time.Now().Add(expires)
+			urlPath, err := restserver.SignURL(key, args[0], expiry)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.ErrOrStderr(), "URL expires at %s\n", expiry.Format(time.RFC3339))
+			fmt.Fprintln(cmd.OutOrStdout(), strings.TrimSuffix(baseURL, "/")+urlPath)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&keyPath, "url-signing-key-file", "", "location of the file containing the URL signing key")
+	cmd.Flags().StringVar(&baseURL, "base-url", "", "URL of the server, for example https://backup.example.com:8000")
+	cmd.Flags().DurationVar(&expires, "expires", 24*time.Hour, "time until the URL expires")
+	_ = cmd.MarkFlagRequired("url-signing-key-file")
+	return cmd
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	restserver "github.com/restic/rest-server"
+	"github.com/spf13/cobra"
+)
+
+// newTokenCommand returns the "token" command with its subcommands for
+// managing the API tokens in the token file.
+func newTokenCommand() *cobra.Command {
+	var tokenPath string
+
+	cmd := &cobra.Command{
+		Use:   "token",
+		Short: "Manage API tokens",
+	}
+	cmd.PersistentFlags().StringVar(&tokenPath, "token-file", "", "location of the token file")
+	_ = cmd.MarkPersistentFlagRequired("token-file")
+
+	var (
+		username string
+		repos    []string
+		scope    string
+		expires  time.Duration
+	)
+	create := &cobra.Command{
+		Use:   "create",
+		Short: "Create a new token and print it",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			token, hash, err := restserver.NewToken()
+			if err != nil {
+				return err
+			}
+			t := restserver.Token{
+				Hash:     hash,
+				Username: username,
+				Repos:    repos,
+				Scope:    scope,
+			}
+			if expires > 0 {
+				t.Expires = time.Now().Add(expires).UTC().Truncate(time.Second)
+			}
+			if err := restserver.AddToken(tokenPath, t); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.ErrOrStderr(), "created token %s for %s\n", t.ID(), t.Username)
+			fmt.Fprintln(cmd.OutOrStdout(), token)
+			return nil
+		},
+	}
+	create.Flags().StringVar(&username, "user", "", "username the token authenticates as")
+	create.Flags().StringSliceVar(&repos, "repo", nil, "repository path prefix the token is restricted to (can be repeated)")
+	create.Flags().StringVar(&scope, "scope", "read", "permission scope of the token, one of (read|append|delete)")
+	create.Flags().DurationVar(&expires, "expires", 7*24*time.Hour, "time until the token expires, 0 for never")
+	_ = create.MarkFlagRequired("user")
+
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "List all tokens",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			tokens, err := restserver.ReadTokens(tokenPath)
+			if err != nil {
+				return err
+			}
+			now := time.Now()
+			for _, t := range tokens {
+				expires := "never"
+				if !t.Expires.IsZero() {
+					expires = t.Expires.Format(time.RFC3339)
+				}
+				if t.Expired(now) {
+					expires += " (expired)"
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "%s  %-16s %-7s %-30s %v\n", t.ID(), t.Username, t.Scope, expires, t.Repos)
+			}
+			return nil
+		},
+	}
+
+	revoke := &cobra.Command{
+		Use:   "revoke <id>",
+		Short: "Remove a token from the token file",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return restserver.RemoveToken(tokenPath, args[0])
+		},
+	}
+
+	cmd.AddCommand(create, list, revoke)
+	return cmd
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/restic/rest-server/repo"
+	"github.com/spf13/cobra"
+)
+
+// repoDir returns the directory of the repository name below dataPath.
+func repoDir(dataPath, name string) (string, error) {
+	for _, elem := range strings.Split(strings.Trim(name, "/"), "/") {
+		if elem == ".." {
+			return "", fmt.Errorf("invalid repository path %q", name)
+		}
+	}
+	return filepath.Join(dataPath, filepath.FromSlash(name)), nil
+}
+
+// newTrashCommand returns the "trash" command with its subcommands for
+// inspecting the trash of a repository and restoring deleted files.
+func newTrashCommand() *cobra.Command {
+	var dataPath string
+
+	cmd := &cobra.Command{
+		Use:   "trash",
+		Short: "Manage files deleted while --trash-retention was set",
+		Long: `Manage files deleted while --trash-retention was set.
+
+The command modifies the data directory directly and must only be used while
+the server is stopped, as a running server does not notice the changes, for
+example to the quota usage. Use the admin API to manage a running server.`,
+	}
+	cmd.PersistentFlags().StringVar(&dataPath, "path", filepath.Join(os.TempDir(), "restic"), "data directory")
+
+	list := &cobra.Command{
+		Use:   "list <repository path>",
+		Short: "List the files in the trash of a repository",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, err := repoDir(dataPath, args[0])
+			if err != nil {
+				return err
+			}
+			entries, err := repo.ListTrash(path)
+			if err != nil {
+				return err
+			}
+			for _, e := range entries {
+				fmt.Fprintf(cmd.OutOrStdout(), "%s  %s  %-16s %10d  %s\n", e.ID, e.Deleted.Local().Format(time.RFC3339), e.User, e.Size, e.Path)
+			}
+			return nil
+		},
+	}
+
+	restore := &cobra.Command{
+		Use:   "restore <repository path> <id>...",
+		Short: "Move files from the trash back into a repository",
+		Args:  cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, err := repoDir(dataPath, args[0])
+			if err != nil {
+				return err
+			}
+			for _, id := range args[1:] {
+				if _, err := repo.RestoreTrash(path, id); err != nil {
+					return fmt.Errorf("cannot restore %s: %w", id, err)
+				}
+				fmt.Fprintf(cmd.ErrOrStderr(), "restored %s\n", id)
+			}
+			return nil
+		},
+	}
+
+	cmd.AddCommand(list, restore)
+	return cmd
+}
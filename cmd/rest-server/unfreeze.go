@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/restic/rest-server/repo"
+	"github.com/spf13/cobra"
+)
+
+// newUnfreezeCommand returns the "unfreeze" command, which allows deletions
+// in repositories frozen by the delete guard again.
+func newUnfreezeCommand() *cobra.Command {
+	var dataPath string
+
+	cmd := &cobra.Command{
+		Use:   "unfreeze <repository path>...",
+		Short: "Unfreeze repositories frozen due to mass deletion",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			for _, name := range args {
+				path, err := repoDir(dataPath, name)
+				if err != nil {
+					return err
+				}
+				if err := repo.Unfreeze(path); err != nil {
+					if errors.Is(err, os.ErrNotExist) {
+						return fmt.Errorf("repository %s is not frozen", name)
+					}
+					return err
+				}
+				fmt.Fprintf(cmd.ErrOrStderr(), "unfroze %s\n", name)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&dataPath, "path", filepath.Join(os.TempDir(), "restic"), "data directory")
+	return cmd
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	restserver "github.com/restic/rest-server"
+	"github.com/restic/rest-server/repo"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// newUserCommand returns the "user" command with its subcommands for managing
+// the users in the htpasswd file.
+func newUserCommand() *cobra.Command {
+	var (
+		dataPath     string
+		htpasswdPath string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "user",
+		Short: "Manage users in the htpasswd file",
+	}
+	cmd.PersistentFlags().StringVar(&dataPath, "path", filepath.Join(os.TempDir(), "restic"), "data directory")
+	cmd.PersistentFlags().StringVar(&htpasswdPath, "htpasswd-file", "", "location of .htpasswd file (default: \"<data directory>/.htpasswd)\"")
+
+	htpasswd := func() string {
+		if htpasswdPath == "" {
+			return filepath.Join(dataPath, ".htpasswd")
+		}
+		return htpasswdPath
+	}
+
+	var (
+		passwordStdin bool
+		appendOnly    bool
+		admin         bool
+		createRepo    bool
+	)
+	add := &cobra.Command{
+		Use:   "add <username>",
+		Short: "Add a new user",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			username := args[0]
+			if !restserver.ValidUsername(username) {
+				return fmt.Errorf("invalid username %q, only letters, numbers, '_', '-', '.' and '@' are allowed", username)
+			}
+			if slices.Contains(repo.ReservedNames, username) {
+				return fmt.Errorf("username %q is reserved", username)
+			}
+			password, err := readPassword(cmd, passwordStdin)
+			if err != nil {
+				return err
+			}
+			var attributes []string
+			if appendOnly {
+				attributes = append(attributes, restserver.AttributeAppendOnly)
+			}
+			if admin {
+				attributes = append(attributes, restserver.AttributeAdmin)
+			}
+			if err := restserver.AddHtpasswdUser(htpasswd(), username, password, attributes); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.ErrOrStderr(), "added user %s to %s\n", username, htpasswd())
+
+			if createRepo {
+				repoPath := filepath.Join(dataPath, username)
+				if err := os.MkdirAll(repoPath, 0700); err != nil {
+					return err
+				}
+				fmt.Fprintf(cmd.ErrOrStderr(), "created directory %s\n", repoPath)
+			}
+			return nil
+		},
+	}
+	add.Flags().BoolVar(&passwordStdin, "password-stdin", false, "read the password from stdin instead of prompting for it")
+	add.Flags().BoolVar(&appendOnly, "append-only", false, "only allow the user to append data to repositories")
+	add.Flags().BoolVar(&admin, "admin", false, "allow the user to use the admin API")
+	add.Flags().BoolVar(&createRepo, "create-repo", false, "create the private repository directory <data directory>/<username>")
+
+	passwd := &cobra.Command{
+		Use:   "passwd <username>",
+		Short: "Change the password of a user",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			password, err := readPassword(cmd, passwordStdin)
+			if err != nil {
+				return err
+			}
+			return restserver.SetHtpasswdPassword(htpasswd(), args[0], password)
+		},
+	}
+	passwd.Flags().BoolVar(&passwordStdin, "password-stdin", false, "read the password from stdin instead of prompting for it")
+
+	remove := &cobra.Command{
+		Use:   "remove <username>",
+		Short: "Remove a user",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return restserver.RemoveHtpasswdUser(htpasswd(), args[0])
+		},
+	}
+
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "List all users",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			entries, err := restserver.ReadHtpasswdEntries(htpasswd())
+			if err != nil {
+				return err
+			}
+			for _, e := range entries {
+				fmt.Fprintf(cmd.OutOrStdout(), "%-20s %s\n", e.Username, strings.Join(e.Attributes, ","))
+			}
+			return nil
+		},
+	}
+
+	cmd.AddCommand(add, passwd, remove, list)
+	return cmd
+}
+
+// readPassword reads a new password either from the first line of stdin or by
+// prompting for it twice on the terminal.
+func readPassword(cmd *cobra.Command, fromStdin bool) (string, error) {
+	if fromStdin {
+		line, err := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", err
+		}
+		password := strings.TrimRight(line, "\r\n")
+		if password == "" {
+			return "", errors.New("empty password")
+		}
+		return password, nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", errors.New("stdin is not a terminal, use --password-stdin")
+	}
+	fmt.Fprint(cmd.ErrOrStderr(), "New password: ")
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(cmd.ErrOrStderr())
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprint(cmd.ErrOrStderr(), "Re-type new password: ")
+	again, err := term.ReadPassword(fd)
+	fmt.Fprintln(cmd.ErrOrStderr())
+	if err != nil {
+		return "", err
+	}
+	if string(password) != string(again) {
+		return "", errors.New("passwords do not match")
+	}
+	if len(password) == 0 {
+		return "", errors.New("empty password")
+	}
+	return string(password), nil
+}
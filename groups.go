@@ -0,0 +1,114 @@
+package restserver
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// GroupFile holds the groups loaded from a group file in the format of
+// Apache's AuthGroupFile. Each non-empty line which is not a comment lists the
+// members of a group:
+//
+//	<group>: <user> <user>...
+//
+// A group may be listed on several lines, its members are merged.
+type GroupFile struct {
+	mutex  sync.Mutex
+	file   *watchedFile
+	groups map[string]map[string]bool
+}
+
+// NewGroupFromFile reads the groups from path. The file is reloaded when it
+// changes on disk or when the process receives SIGHUP.
+func NewGroupFromFile(path string) (*GroupFile, error) {
+	file, err := newWatchedFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &GroupFile{file: file}
+	if err := g.Reload(); err != nil {
+		return nil, err
+	}
+
+	reloadOnSIGHUP("group file", g.Reload)
+
+	return g, nil
+}
+
+// Reload reloads the group file. If the file cannot be parsed, the previous
+// groups are kept and the error is returned.
+func (g *GroupFile) Reload() error {
+	groups, err := parseGroupFile(g.file.path)
+	if err != nil {
+		return err
+	}
+
+	g.mutex.Lock()
+	g.groups = groups
+	g.mutex.Unlock()
+	return nil
+}
+
+func parseGroupFile(filename string) (map[string]map[string]bool, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	groups := make(map[string]map[string]bool)
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1024*1024)
+	for lineNo := 1; sc.Scan(); lineNo++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, members, ok := strings.Cut(line, ":")
+		name = strings.TrimSpace(name)
+		if !ok || !validUsernameRegexp.MatchString(name) {
+			return nil, fmt.Errorf("%s:%d: expected <group>: <user>..., got %q", filename, lineNo, line)
+		}
+		if groups[name] == nil {
+			groups[name] = make(map[string]bool)
+		}
+		for _, user := range strings.Fields(members) {
+			groups[name][user] = true
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// ReloadCheck reloads the group file if it changed on disk.
+func (g *GroupFile) ReloadCheck() {
+	if !g.file.changed() {
+		return
+	}
+	if err := g.Reload(); err != nil {
+		log.Printf("Could not reload group file: %v", err)
+		return
+	}
+	log.Printf("Reloaded group file")
+}
+
+// IsMember returns true if username is a member of group.
+func (g *GroupFile) IsMember(username, group string) bool {
+	g.ReloadCheck()
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	return g.groups[group][username]
+}
@@ -0,0 +1,94 @@
+package restserver
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testGroups = `
+# teams
+ops: alice bob
+dev: carol
+ops: dave
+`
+
+func writeTestGroups(t *testing.T, content string) string {
+	fn := filepath.Join(t.TempDir(), "groups")
+	if err := os.WriteFile(fn, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return fn
+}
+
+func TestGroupFile(t *testing.T) {
+	groups, err := NewGroupFromFile(writeTestGroups(t, testGroups))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		user  string
+		group string
+		want  bool
+	}{
+		{"alice", "ops", true},
+		{"dave", "ops", true},
+		{"carol", "ops", false},
+		{"carol", "dev", true},
+		{"alice", "missing", false},
+	}
+	for _, test := range tests {
+		if got := groups.IsMember(test.user, test.group); got != test.want {
+			t.Errorf("IsMember(%q, %q): want %v, got %v", test.user, test.group, test.want, got)
+		}
+	}
+
+	// groups from the group file can be used in the ACL
+	acl, err := NewACLFromFile(writeTestACL(t, "/ops/* @ops append\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	acl.Groups = groups
+	if access := acl.Access("dave", []string{"ops", "db"}); access != AccessAppend {
+		t.Errorf("wrong access for group member, want %v, got %v", AccessAppend, access)
+	}
+	if access := acl.Access("carol", []string{"ops", "db"}); access != AccessNone {
+		t.Errorf("wrong access for non-member, want %v, got %v", AccessNone, access)
+	}
+
+	if _, err := NewGroupFromFile(writeTestGroups(t, "ops alice\n")); err == nil {
+		t.Error("invalid group file accepted")
+	}
+}
+
+func TestGroupHandler(t *testing.T) {
+	mux, _, _, _, cleanup := createTestHandler(t, &Server{
+		ProxyAuthUsername: "X-Remote-User",
+		GroupPath:         writeTestGroups(t, testGroups),
+		PrivateRepos:      true,
+		PanicOnError:      true,
+	})
+	defer cleanup()
+
+	request := func(user, method, path string) *http.Request {
+		req := newRequest(t, method, path, strings.NewReader(""))
+		req.Header.Set("X-Remote-User", user)
+		return req
+	}
+
+	for _, test := range []struct {
+		req  *http.Request
+		code int
+	}{
+		{request("alice", "POST", "/ops/db/?create=true"), http.StatusOK},
+		{request("bob", "GET", "/ops/db/config"), http.StatusNotFound},
+		{request("carol", "GET", "/ops/db/config"), http.StatusUnauthorized},
+		{request("carol", "POST", "/carol/?create=true"), http.StatusOK},
+		{request("alice", "GET", "/carol/config"), http.StatusUnauthorized},
+	} {
+		checkRequest(t, mux.ServeHTTP, test.req, []wantFunc{wantCode(test.code)})
+	}
+}
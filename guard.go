@@ -0,0 +1,80 @@
+package restserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/restic/rest-server/repo"
+)
+
+// webhookTimeout is the timeout for sending a notification to
+// Server.DeleteGuardWebhook.
+const webhookTimeout = 10 * time.Second
+
+// FreezeEvent is sent as JSON to Server.DeleteGuardWebhook when a repository
+// is frozen.
+type FreezeEvent struct {
+	Event string `json:"event"`
+	Repo  string `json:"repo"`
+	repo.FrozenInfo
+}
+
+// onFreeze is called by the delete guard after it froze the repository at
+// fsPath.
+func (s *Server) onFreeze(fsPath string, info repo.FrozenInfo) {
+	repoPath := fsPath
+	if rel, err := filepath.Rel(s.Path, fsPath); err == nil {
+		repoPath = "/" + strings.TrimPrefix(filepath.ToSlash(rel), ".")
+	}
+
+	log.Printf("Froze repository %s after deletions by %q: %s", repoPath, info.User, info.Reason)
+	metricRepoFrozenTotal.WithLabelValues(strings.TrimPrefix(repoPath, "/")).Inc()
+
+	if s.DeleteGuardWebhook == "" {
+		return
+	}
+	body, err := json.Marshal(FreezeEvent{Event: "frozen", Repo: repoPath, FrozenInfo: info})
+	if err != nil {
+		log.Printf("Could not encode webhook payload: %v", err)
+		return
+	}
+	go func() {
+		client := http.Client{Timeout: webhookTimeout}
+		res, err := client.Post(s.DeleteGuardWebhook, "application/json", bytes.NewReader(body))
+		if err != nil {
+			log.Printf("Could not send webhook for frozen repository %s: %v", repoPath, err)
+			return
+		}
+		_ = res.Body.Close()
+		if res.StatusCode >= 300 {
+			log.Printf("Webhook for frozen repository %s returned %s", repoPath, res.Status)
+		}
+	}()
+}
+
+func (s *Server) adminUnfreezeRepo(w http.ResponseWriter, r *http.Request) {
+	fsPath, ok := s.adminRepoPath(r.PathValue("path"))
+	if !ok || !isRepo(fsPath) {
+		httpDefaultError(w, http.StatusNotFound)
+		return
+	}
+	err := repo.Unfreeze(fsPath)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		http.Error(w, "repository is not frozen", http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("admin: cannot unfreeze %s: %v", fsPath, err)
+		httpDefaultError(w, http.StatusInternalServerError)
+		return
+	}
+	log.Printf("admin: unfroze repository %s", fsPath)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,123 @@
+package restserver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/restic/rest-server/repo"
+)
+
+func TestDeleteGuard(t *testing.T) {
+	events := make(chan FreezeEvent, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev FreezeEvent
+		if err := json.NewDecoder(r.Body).Decode(&ev); err != nil {
+			t.Errorf("invalid webhook payload: %v", err)
+		}
+		events <- ev
+	}))
+	defer webhook.Close()
+
+	mux, data, fileID, tempdir, cleanup := createTestHandler(t, &Server{
+		NoAuth:               true,
+		DeleteGuardWindow:    time.Hour,
+		DeleteGuardSnapshots: 0.5,
+		DeleteGuardWebhook:   webhook.URL,
+		PanicOnError:         true,
+	})
+	defer cleanup()
+
+	checkRequest(t, mux.ServeHTTP, newRequest(t, "POST", "/?create=true", nil), []wantFunc{wantCode(http.StatusOK)})
+	checkRequest(t, mux.ServeHTTP, newRequest(t, "POST", "/data/"+fileID, strings.NewReader(data)), []wantFunc{wantCode(http.StatusOK)})
+	var snapshots []string
+	for i := 0; i < 4; i++ {
+		content := fmt.Sprintf("snapshot %d", i)
+		hash := sha256.Sum256([]byte(content))
+		id := hex.EncodeToString(hash[:])
+		checkRequest(t, mux.ServeHTTP, newRequest(t, "POST", "/snapshots/"+id, strings.NewReader(content)), []wantFunc{wantCode(http.StatusOK)})
+		snapshots = append(snapshots, id)
+	}
+
+	// deleting files which do not exist does not count
+	for i := 0; i < 3; i++ {
+		checkRequest(t, mux.ServeHTTP, newRequest(t, "DELETE", "/snapshots/"+strings.Repeat(fmt.Sprint(i), 64), nil), []wantFunc{wantCode(http.StatusOK)})
+	}
+	if repo.IsFrozen(tempdir) {
+		t.Fatal("repository was frozen by deleting missing files")
+	}
+
+	// deleting half of the snapshots is allowed, more freezes the repository
+	for _, id := range snapshots[:2] {
+		checkRequest(t, mux.ServeHTTP, newRequest(t, "DELETE", "/snapshots/"+id, nil), []wantFunc{wantCode(http.StatusOK)})
+	}
+	checkRequest(t, mux.ServeHTTP, newRequest(t, "DELETE", "/snapshots/"+snapshots[2], nil), []wantFunc{wantCode(http.StatusForbidden)})
+	if !repo.IsFrozen(tempdir) {
+		t.Fatal("repository was not frozen")
+	}
+	select {
+	case ev := <-events:
+		if ev.Event != "frozen" || ev.Repo != "/" || ev.Reason == "" {
+			t.Errorf("unexpected webhook payload %+v", ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("webhook was not called")
+	}
+
+	// a frozen repository is append-only
+	checkRequest(t, mux.ServeHTTP, newRequest(t, "DELETE", "/data/"+fileID, nil), []wantFunc{wantCode(http.StatusForbidden)})
+	checkRequest(t, mux.ServeHTTP, newRequest(t, "DELETE", "/config", nil), []wantFunc{wantCode(http.StatusForbidden)})
+	checkRequest(t, mux.ServeHTTP, newRequest(t, "GET", "/snapshots/"+snapshots[2], nil), []wantFunc{wantCode(http.StatusOK)})
+
+	// after unfreezing, the deletions are counted from scratch
+	if err := repo.Unfreeze(tempdir); err != nil {
+		t.Fatal(err)
+	}
+	checkRequest(t, mux.ServeHTTP, newRequest(t, "DELETE", "/snapshots/"+snapshots[2], nil), []wantFunc{wantCode(http.StatusOK)})
+	checkRequest(t, mux.ServeHTTP, newRequest(t, "DELETE", "/data/"+fileID, nil), []wantFunc{wantCode(http.StatusOK)})
+
+	// deleting the config always freezes the repository
+	checkRequest(t, mux.ServeHTTP, newRequest(t, "POST", "/config", strings.NewReader("config")), []wantFunc{wantCode(http.StatusOK)})
+	checkRequest(t, mux.ServeHTTP, newRequest(t, "DELETE", "/config", nil), []wantFunc{wantCode(http.StatusForbidden)})
+	if !repo.IsFrozen(tempdir) {
+		t.Fatal("repository was not frozen by deleting the config")
+	}
+	select {
+	case ev := <-events:
+		if ev.Reason != "config deleted" {
+			t.Errorf("unexpected webhook payload %+v", ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("webhook was not called")
+	}
+	checkRequest(t, mux.ServeHTTP, newRequest(t, "GET", "/config", nil), []wantFunc{wantCode(http.StatusOK), wantBody("config")})
+}
+
+func TestAdminFrozenRepo(t *testing.T) {
+	_, tempdir, request := adminTestHandler(t, &Server{})
+	if err := os.WriteFile(filepath.Join(tempdir, "alice", repo.FrozenFile), []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if rr := request("DELETE", "/_admin/repos/alice", ""); rr.Code != http.StatusLocked {
+		t.Fatalf("delete frozen repository: want %v, got %v", http.StatusLocked, rr.Code)
+	}
+	if rr := request("PATCH", "/_admin/repos/alice", `{"path": "bob"}`); rr.Code != http.StatusLocked {
+		t.Fatalf("rename frozen repository: want %v, got %v", http.StatusLocked, rr.Code)
+	}
+
+	if rr := request("POST", "/_admin/unfreeze/alice", ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("unfreeze: want %v, got %v", http.StatusNoContent, rr.Code)
+	}
+	if rr := request("PATCH", "/_admin/repos/alice", `{"path": "bob"}`); rr.Code != http.StatusNoContent {
+		t.Fatalf("rename unfrozen repository: want %v, got %v", http.StatusNoContent, rr.Code)
+	}
+}
@@ -6,8 +6,10 @@ import (
 	"net/http"
 	"path"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/restic/rest-server/quota"
 	"github.com/restic/rest-server/repo"
@@ -17,28 +19,79 @@ import (
 type Server struct {
 	Path                 string
 	HtpasswdPath         string
+	HtpasswdUpgradeSHA   bool
+	HtpasswdRejectSHA    bool
+	TokenPath            string
+	JWKSPath             string
+	JWTIssuer            string
+	JWTAudience          string
+	JWTUsernameClaim     string
+	JWTReposClaim        string
+	ACLPath              string
+	GroupPath            string
 	Listen               string
 	Log                  string
 	CPUProfile           string
 	TLSKey               string
 	TLSCert              string
 	TLSMinVer            string
+	TLSClientCA          string
+	TLSClientUsername    string
 	TLS                  bool
 	NoAuth               bool
 	ProxyAuthUsername    string
+	ProxyAuthTrusted     []string
+	URLSigningKeyPath    string
+	AuthCommand          string
+	AuthCommandTimeout   time.Duration
 	AppendOnly           bool
 	PrivateRepos         bool
 	Prometheus           bool
 	PrometheusNoAuth     bool
+	AdminAPI             bool
+	PasswordChange       bool
+	MinPasswordLength    int
 	Debug                bool
 	MaxRepoSize          int64
 	PanicOnError         bool
+	MaxAuthFailuresIP    int
+	MaxAuthFailuresUser  int
+	AuthFailureWindow    time.Duration
+	AuthLockout          time.Duration
 	NoVerifyUpload       bool
 	GroupAccessibleRepos bool
+	TrashRetention       time.Duration
+	MinRetention         time.Duration
+	ProtectedRepos       []string
+	DeleteGuardWindow    time.Duration
+	DeleteGuardSnapshots float64
+	DeleteGuardData      float64
+	DeleteGuardWebhook   string
+	ScrubInterval        time.Duration
+	ScrubRate            int64
+	VerifyRead           bool
+	MirrorPath           string
+	Memory               bool
+	MemoryMaxBytes       int64
+	DataPaths            []string // additional directories for data files
 
-	htpasswdFile *HtpasswdFile
-	quotaManager *quota.Manager
-	fsyncWarning sync.Once
+	// Authenticator checks the credentials of requests which are not
+	// authenticated by client certificates or tokens. If it is nil, the
+	// authentication method is selected based on the settings above.
+	Authenticator Authenticator
+
+	proxies       *trustedProxies
+	htpasswdFile  *HtpasswdFile
+	tokens        *TokenFile
+	jwtVerifier   *JWTVerifier
+	acl           *ACLFile
+	deleteGuard   *repo.DeleteGuard
+	storage       repo.Storage // nil for the local filesystem
+	groups        *GroupFile
+	throttle      *loginThrottle
+	quotaManager  *quota.Manager
+	urlSigningKey []byte
+	fsyncWarning  sync.Once
 }
 
 // MaxFolderDepth is the maxDepth param passed to splitURLPath.
@@ -56,11 +109,26 @@ func httpDefaultError(w http.ResponseWriter, code int) {
 // authentication, etc) and then passes it on to repo.Handler for actual
 // REST API processing.
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// First of all, check auth (will always pass if NoAuth is set)
-	username, ok := s.checkAuth(r)
-	if !ok {
-		httpDefaultError(w, http.StatusUnauthorized)
-		return
+	// First of all, check auth (will always pass if NoAuth is set). Signed
+	// URLs carry their own authorization.
+	var id identity
+	if s.urlSigningKey != nil && strings.HasPrefix(r.URL.Path, SignedURLPrefix) {
+		var code int
+		var err error
+		id, code, err = s.verifySignedURL(r)
+		if err != nil {
+			if s.Debug {
+				log.Printf("Rejected signed URL %s: %v", r.URL.Path, err)
+			}
+			httpDefaultError(w, code)
+			return
+		}
+	} else {
+		var ok bool
+		id, ok = s.authenticate(w, r)
+		if !ok {
+			return
+		}
 	}
 
 	// Perform the path parsing to determine the repo folder and remainder for the
@@ -73,13 +141,30 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if the current user is allowed to access this path
-	if !s.NoAuth && s.PrivateRepos {
-		if len(folderPath) == 0 || folderPath[0] != username {
+	if !s.NoAuth && s.PrivateRepos && !id.signed {
+		if len(folderPath) == 0 || (folderPath[0] != id.username && !s.isGroupMember(id.username, folderPath[0])) {
 			httpDefaultError(w, http.StatusUnauthorized)
 			return
 		}
 	}
 
+	// Tokens may be restricted to some repositories
+	if !id.allowedRepo(folderPath) {
+		httpDefaultError(w, http.StatusForbidden)
+		return
+	}
+
+	// Determine the access level, which may be restricted for the user and
+	// by the ACL
+	access := id.access
+	if !s.NoAuth && s.acl != nil && !id.signed {
+		access = min(access, s.acl.Access(id.username, folderPath))
+	}
+	if access == AccessNone {
+		httpDefaultError(w, http.StatusForbidden)
+		return
+	}
+
 	// Determine filesystem path for this repo
 	fsPath, err := join(s.Path, folderPath...)
 	if err != nil {
@@ -89,18 +174,37 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var mirrorPath string
+	if s.MirrorPath != "" {
+		mirrorPath, err = join(s.MirrorPath, folderPath...)
+		if err != nil {
+			log.Printf("Unexpected join error for path %q", r.URL.Path)
+			httpDefaultError(w, http.StatusNotFound)
+			return
+		}
+	}
+
 	// Pass the request to the repo.Handler
 	opt := repo.Options{
-		AppendOnly:      s.AppendOnly,
+		AppendOnly:      s.AppendOnly || access == AccessAppend,
+		ReadOnly:        access == AccessRead,
 		Debug:           s.Debug,
 		QuotaManager:    s.quotaManager, // may be nil
+		Storage:         s.storage,      // may be nil
 		PanicOnError:    s.PanicOnError,
 		NoVerifyUpload:  s.NoVerifyUpload,
 		FsyncWarning:    &s.fsyncWarning,
 		GroupAccessible: s.GroupAccessibleRepos,
+		Trash:           s.TrashRetention > 0,
+		MinRetention:    s.MinRetention,
+		Protected:       s.isProtected(folderPath),
+		DeleteGuard:     s.deleteGuard, // may be nil
+		VerifyRead:      s.VerifyRead,
+		MirrorPath:      mirrorPath,
+		Username:        id.username,
 	}
 	if s.Prometheus {
-		opt.BlobMetricFunc = makeBlobMetricFunc(username, folderPath)
+		opt.BlobMetricFunc = makeBlobMetricFunc(id.username, folderPath)
 	}
 	repoHandler, err := repo.New(fsPath, opt)
 	if err != nil {
@@ -112,6 +216,18 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	repoHandler.ServeHTTP(w, r)
 }
 
+// isProtected returns true if deletions in the repository at folderPath must
+// be approved.
+func (s *Server) isProtected(folderPath []string) bool {
+	repoPath := "/" + strings.Join(folderPath, "/")
+	for _, p := range s.ProtectedRepos {
+		if path.Clean("/"+p) == repoPath {
+			return true
+		}
+	}
+	return false
+}
+
 func valid(name string) bool {
 	// taken from net/http.Dir
 	if strings.Contains(name, "\x00") {
@@ -195,7 +311,7 @@ func splitURLPath(urlPath string, maxDepth int) (folderPath []string, remainder
 // safe.
 func folderPathValid(folderPath []string) bool {
 	for _, name := range folderPath {
-		if name == "" || name == ".." || name == "." || !valid(name) {
+		if name == "" || name == ".." || name == "." || !valid(name) || slices.Contains(repo.ReservedNames, name) {
 			return false
 		}
 	}
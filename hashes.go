@@ -0,0 +1,326 @@
+package restserver
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// This file implements the password hash formats which are used by common
+// htpasswd tooling in addition to {SHA} and bcrypt:
+//
+//	$apr1$, $1$                MD5-crypt (Apache htpasswd -m, openssl passwd -apr1)
+//	$5$, $6$                   SHA-256-crypt and SHA-512-crypt (mkpasswd, openssl passwd -5/-6)
+//	$argon2id$, $argon2i$      Argon2 in PHC string format (argon2 CLI, htpasswd -2 from Apache 2.5)
+//	$scrypt$                   scrypt in PHC string format (passlib)
+
+// cryptAlphabet is the alphabet of the base64 variant used by crypt(3).
+const cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// cryptEncoder builds the base64 variant used by crypt(3), which encodes
+// groups of three bytes in little-endian order.
+type cryptEncoder struct {
+	strings.Builder
+}
+
+func (e *cryptEncoder) encode(b2, b1, b0 byte, n int) {
+	v := uint(b2)<<16 | uint(b1)<<8 | uint(b0)
+	for ; n > 0; n-- {
+		e.WriteByte(cryptAlphabet[v&0x3f])
+		v >>= 6
+	}
+}
+
+// md5Crypt computes the MD5-crypt hash of password, magic is either "$1$" or
+// "$apr1$".
+func md5Crypt(password, salt []byte, magic string) string {
+	if i := strings.IndexByte(string(salt), '$'); i >= 0 {
+		salt = salt[:i]
+	}
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+
+	alt := md5.New()
+	alt.Write(password)
+	alt.Write(salt)
+	alt.Write(password)
+	altSum := alt.Sum(nil)
+
+	d := md5.New()
+	d.Write(password)
+	d.Write([]byte(magic))
+	d.Write(salt)
+	for i := len(password); i > 0; i -= 16 {
+		d.Write(altSum[:min(i, 16)])
+	}
+	for i := len(password); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			d.Write([]byte{0})
+		} else {
+			d.Write(password[:1])
+		}
+	}
+	final := d.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		d := md5.New()
+		if i&1 != 0 {
+			d.Write(password)
+		} else {
+			d.Write(final)
+		}
+		if i%3 != 0 {
+			d.Write(salt)
+		}
+		if i%7 != 0 {
+			d.Write(password)
+		}
+		if i&1 != 0 {
+			d.Write(final)
+		} else {
+			d.Write(password)
+		}
+		final = d.Sum(nil)
+	}
+
+	var e cryptEncoder
+	e.WriteString(magic)
+	e.Write(salt)
+	e.WriteByte('$')
+	e.encode(final[0], final[6], final[12], 4)
+	e.encode(final[1], final[7], final[13], 4)
+	e.encode(final[2], final[8], final[14], 4)
+	e.encode(final[3], final[9], final[15], 4)
+	e.encode(final[4], final[10], final[5], 4)
+	e.encode(0, 0, final[11], 2)
+	return e.String()
+}
+
+// Byte order of the final encoding step of SHA-crypt.
+var (
+	sha256CryptOrder = [][3]int{
+		{0, 10, 20}, {21, 1, 11}, {12, 22, 2}, {3, 13, 23}, {24, 4, 14},
+		{15, 25, 5}, {6, 16, 26}, {27, 7, 17}, {18, 28, 8}, {9, 19, 29},
+	}
+	sha512CryptOrder = [][3]int{
+		{0, 21, 42}, {22, 43, 1}, {44, 2, 23}, {3, 24, 45}, {25, 46, 4},
+		{47, 5, 26}, {6, 27, 48}, {28, 49, 7}, {50, 8, 29}, {9, 30, 51},
+		{31, 52, 10}, {53, 11, 32}, {12, 33, 54}, {34, 55, 13}, {56, 14, 35},
+		{15, 36, 57}, {37, 58, 16}, {59, 17, 38}, {18, 39, 60}, {40, 61, 19},
+		{62, 20, 41},
+	}
+)
+
+// shaCrypt computes the SHA-crypt hash of password as specified in
+// https://www.akkadia.org/drepper/SHA-crypt.txt, magic is either "$5$" for
+// SHA-256 or "$6$" for SHA-512. setting is the part of the hash after magic.
+func shaCrypt(password []byte, setting string, magic string) (string, error) {
+	newHash := sha256.New
+	if magic == "$6$" {
+		newHash = sha512.New
+	}
+
+	rounds, customRounds := 5000, false
+	if strings.HasPrefix(setting, "rounds=") {
+		i := strings.IndexByte(setting, '$')
+		if i < 0 {
+			return "", fmt.Errorf("invalid rounds in %q", setting)
+		}
+		n, err := strconv.ParseUint(setting[len("rounds="):i], 10, 32)
+		if err != nil {
+			return "", fmt.Errorf("invalid rounds in %q", setting)
+		}
+		rounds = min(max(int(n), 1000), 999999999)
+		customRounds = true
+		setting = setting[i+1:]
+	}
+	salt := setting
+	if i := strings.IndexByte(salt, '$'); i >= 0 {
+		salt = salt[:i]
+	}
+	if len(salt) > 16 {
+		salt = salt[:16]
+	}
+
+	b := newHash()
+	b.Write(password)
+	b.Write([]byte(salt))
+	b.Write(password)
+	bSum := b.Sum(nil)
+
+	a := newHash()
+	a.Write(password)
+	a.Write([]byte(salt))
+	i := len(password)
+	for ; i > len(bSum); i -= len(bSum) {
+		a.Write(bSum)
+	}
+	a.Write(bSum[:i])
+	for i := len(password); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			a.Write(bSum)
+		} else {
+			a.Write(password)
+		}
+	}
+	final := a.Sum(nil)
+
+	p := repeatedDigest(newHash(), password, len(password), len(password))
+	s := repeatedDigest(newHash(), []byte(salt), 16+int(final[0]), len(salt))
+
+	for r := 0; r < rounds; r++ {
+		c := newHash()
+		if r&1 != 0 {
+			c.Write(p)
+		} else {
+			c.Write(final)
+		}
+		if r%3 != 0 {
+			c.Write(s)
+		}
+		if r%7 != 0 {
+			c.Write(p)
+		}
+		if r&1 != 0 {
+			c.Write(final)
+		} else {
+			c.Write(p)
+		}
+		final = c.Sum(nil)
+	}
+
+	var e cryptEncoder
+	e.WriteString(magic)
+	if customRounds {
+		fmt.Fprintf(&e, "rounds=%d$", rounds)
+	}
+	e.WriteString(salt)
+	e.WriteByte('$')
+	if magic == "$6$" {
+		for _, o := range sha512CryptOrder {
+			e.encode(final[o[0]], final[o[1]], final[o[2]], 4)
+		}
+		e.encode(0, 0, final[63], 2)
+	} else {
+		for _, o := range sha256CryptOrder {
+			e.encode(final[o[0]], final[o[1]], final[o[2]], 4)
+		}
+		e.encode(0, final[31], final[30], 3)
+	}
+	return e.String(), nil
+}
+
+// repeatedDigest hashes data count times and returns the digest repeated to
+// length bytes.
+func repeatedDigest(h hash.Hash, data []byte, count int, length int) []byte {
+	for i := 0; i < count; i++ {
+		h.Write(data)
+	}
+	sum := h.Sum(nil)
+
+	out := make([]byte, 0, length)
+	for len(out) < length {
+		out = append(out, sum[:min(len(sum), length-len(out))]...)
+	}
+	return out
+}
+
+// phcHash is a password hash in PHC string format:
+// $<id>[$v=<version>]$<param>=<value>(,<param>=<value>)*$<salt>$<hash>
+type phcHash struct {
+	id      string
+	version string
+	params  map[string]uint64
+	salt    []byte
+	hash    []byte
+}
+
+func parsePHC(s string) (phcHash, error) {
+	fields := strings.Split(s, "$")
+	if len(fields) < 5 || fields[0] != "" {
+		return phcHash{}, fmt.Errorf("invalid hash format")
+	}
+	h := phcHash{id: fields[1], params: make(map[string]uint64)}
+	fields = fields[2:]
+	if strings.HasPrefix(fields[0], "v=") {
+		h.version = fields[0][2:]
+		fields = fields[1:]
+	}
+	if len(fields) != 3 {
+		return phcHash{}, fmt.Errorf("invalid hash format")
+	}
+	for _, param := range strings.Split(fields[0], ",") {
+		name, value, ok := strings.Cut(param, "=")
+		if !ok {
+			return phcHash{}, fmt.Errorf("invalid parameter %q", param)
+		}
+		v, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return phcHash{}, fmt.Errorf("invalid parameter %q", param)
+		}
+		h.params[name] = v
+	}
+
+	var err error
+	if h.salt, err = base64.RawStdEncoding.DecodeString(fields[1]); err != nil {
+		return phcHash{}, fmt.Errorf("invalid salt: %w", err)
+	}
+	if h.hash, err = base64.RawStdEncoding.DecodeString(fields[2]); err != nil {
+		return phcHash{}, fmt.Errorf("invalid hash: %w", err)
+	}
+	if len(h.hash) == 0 {
+		return phcHash{}, fmt.Errorf("empty hash")
+	}
+	return h, nil
+}
+
+// verifyArgon2 checks password against an Argon2i or Argon2id hash.
+func verifyArgon2(hashedPassword, password string) (bool, error) {
+	h, err := parsePHC(hashedPassword)
+	if err != nil {
+		return false, err
+	}
+	if h.version != "" && h.version != strconv.Itoa(argon2.Version) {
+		return false, fmt.Errorf("unsupported argon2 version %v", h.version)
+	}
+	m, t, p := h.params["m"], h.params["t"], h.params["p"]
+	if m == 0 || t == 0 || p == 0 || p > 255 {
+		return false, fmt.Errorf("invalid argon2 parameters")
+	}
+
+	var key []byte
+	if h.id == "argon2id" {
+		key = argon2.IDKey([]byte(password), h.salt, uint32(t), uint32(m), uint8(p), uint32(len(h.hash)))
+	} else {
+		key = argon2.Key([]byte(password), h.salt, uint32(t), uint32(m), uint8(p), uint32(len(h.hash)))
+	}
+	return subtle.ConstantTimeCompare(key, h.hash) == 1, nil
+}
+
+// verifyScrypt checks password against a scrypt hash.
+func verifyScrypt(hashedPassword, password string) (bool, error) {
+	h, err := parsePHC(hashedPassword)
+	if err != nil {
+		return false, err
+	}
+	ln, r, p := h.params["ln"], h.params["r"], h.params["p"]
+	if ln == 0 || ln > 30 || r == 0 || p == 0 {
+		return false, fmt.Errorf("invalid scrypt parameters")
+	}
+
+	key, err := scrypt.Key([]byte(password), h.salt, 1<<ln, int(r), int(p), len(h.hash))
+	if err != nil {
+		return false, err
+	}
+	return subtle.ConstantTimeCompare(key, h.hash) == 1, nil
+}
@@ -0,0 +1,101 @@
+package restserver
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/restic/rest-server/repo"
+)
+
+func (s *Server) adminListHolds(w http.ResponseWriter, r *http.Request) {
+	fsPath, ok := s.adminRepoPath(r.PathValue("path"))
+	if !ok || !isRepo(fsPath) {
+		httpDefaultError(w, http.StatusNotFound)
+		return
+	}
+	holds, err := repo.ListHolds(fsPath)
+	if err != nil {
+		log.Printf("admin: cannot list holds of %s: %v", fsPath, err)
+		httpDefaultError(w, http.StatusInternalServerError)
+		return
+	}
+	if holds == nil {
+		holds = []repo.Hold{}
+	}
+	sendJSON(w, http.StatusOK, holds)
+}
+
+func (s *Server) adminPlaceHold(w http.ResponseWriter, r *http.Request) {
+	fsPath, ok := s.adminRepoPath(r.PathValue("path"))
+	if !ok || !isRepo(fsPath) {
+		httpDefaultError(w, http.StatusNotFound)
+		return
+	}
+	var req struct {
+		Type   string `json:"type"`
+		ID     string `json:"id"`
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	hold := repo.Hold{
+		Type:    req.Type,
+		ID:      req.ID,
+		Reason:  req.Reason,
+		User:    adminUsername(r),
+		Created: time.Now().UTC(),
+	}
+	size, err := repo.PlaceHold(s.storage, fsPath, hold)
+	switch {
+	case errors.Is(err, os.ErrInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, os.ErrNotExist):
+		httpDefaultError(w, http.StatusNotFound)
+		return
+	case errors.Is(err, os.ErrExist):
+		http.Error(w, "object is already under legal hold", http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("admin: cannot place hold on %s/%s in %s: %v", req.Type, req.ID, fsPath, err)
+		httpDefaultError(w, http.StatusInternalServerError)
+		return
+	}
+	if s.quotaManager != nil {
+		s.quotaManager.IncUsage(size)
+	}
+	log.Printf("admin: placed hold on %s/%s in %s", req.Type, req.ID, fsPath)
+	sendJSON(w, http.StatusCreated, hold)
+}
+
+func (s *Server) adminReleaseHold(w http.ResponseWriter, r *http.Request) {
+	fsPath, ok := s.adminRepoPath(r.PathValue("path"))
+	if !ok || !isRepo(fsPath) {
+		httpDefaultError(w, http.StatusNotFound)
+		return
+	}
+	objectType, objectID := r.URL.Query().Get("type"), r.URL.Query().Get("id")
+
+	freed, err := repo.ReleaseHold(fsPath, objectType, objectID)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		httpDefaultError(w, http.StatusNotFound)
+		return
+	case err != nil:
+		log.Printf("admin: cannot release hold on %s/%s in %s: %v", objectType, objectID, fsPath, err)
+		httpDefaultError(w, http.StatusInternalServerError)
+		return
+	}
+	if s.quotaManager != nil {
+		s.quotaManager.DecUsage(freed)
+	}
+	log.Printf("admin: released hold on %s/%s in %s", objectType, objectID, fsPath)
+	w.WriteHeader(http.StatusNoContent)
+}
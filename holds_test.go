@@ -0,0 +1,116 @@
+package restserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/restic/rest-server/repo"
+)
+
+func TestLegalHold(t *testing.T) {
+	dir := t.TempDir()
+	htpasswd := filepath.Join(dir, ".htpasswd")
+	pwd := "$2y$05$z/OEmNQamd6m6LSegUErh.r/Owk9Xwmc5lxDheIuHY2Z7XiS6FtJm"
+	if err := os.WriteFile(htpasswd, []byte("root:"+pwd+":admin\nrestic:"+pwd+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	server := &Server{
+		HtpasswdPath:   htpasswd,
+		AdminAPI:       true,
+		TrashRetention: time.Hour,
+	}
+	mux, data, fileID, tempdir, cleanup := createTestHandler(t, server)
+	defer cleanup()
+	repoDir := filepath.Join(tempdir, "restic")
+
+	request := func(user, method, path, body string) *httptest.ResponseRecorder {
+		req := newRequest(t, method, path, strings.NewReader(body))
+		req.SetBasicAuth(user, "test")
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	for _, req := range [][3]string{
+		{"POST", "/restic/?create=true", ""},
+		{"POST", "/restic/config", "config"},
+		{"POST", "/restic/data/" + fileID, data},
+		{"POST", "/restic/snapshots/" + fileID, data},
+	} {
+		if rr := request("restic", req[0], req[1], req[2]); rr.Code != http.StatusOK {
+			t.Fatalf("%s %s: want %v, got %v", req[0], req[1], http.StatusOK, rr.Code)
+		}
+	}
+
+	if rr := request("restic", "POST", "/_admin/holds/restic", `{"type": "data", "id": "`+fileID+`"}`); rr.Code != http.StatusForbidden {
+		t.Fatalf("non-admin user: want %v, got %v", http.StatusForbidden, rr.Code)
+	}
+	for _, body := range []string{`{"type": "locks", "id": "` + fileID + `"}`, `{"type": "data", "id": "../config"}`} {
+		if rr := request("root", "POST", "/_admin/holds/restic", body); rr.Code != http.StatusBadRequest {
+			t.Errorf("invalid hold %s: want %v, got %v", body, http.StatusBadRequest, rr.Code)
+		}
+	}
+	if rr := request("root", "POST", "/_admin/holds/restic", `{"type": "index", "id": "`+fileID+`"}`); rr.Code != http.StatusNotFound {
+		t.Errorf("hold on missing object: want %v, got %v", http.StatusNotFound, rr.Code)
+	}
+
+	rr := request("root", "POST", "/_admin/holds/restic", `{"type": "data", "id": "`+fileID+`", "reason": "case 42"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("place hold: want %v, got %v: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	if rr := request("root", "POST", "/_admin/holds/restic", `{"type": "data", "id": "`+fileID+`"}`); rr.Code != http.StatusConflict {
+		t.Errorf("duplicate hold: want %v, got %v", http.StatusConflict, rr.Code)
+	}
+
+	// held objects cannot be deleted, neither by clients nor with the repository
+	if rr := request("restic", "DELETE", "/restic/data/"+fileID, ""); rr.Code != http.StatusLocked {
+		t.Errorf("delete held object: want %v, got %v", http.StatusLocked, rr.Code)
+	}
+	if rr := request("root", "DELETE", "/_admin/repos/restic", ""); rr.Code != http.StatusLocked {
+		t.Errorf("delete repository with holds: want %v, got %v", http.StatusLocked, rr.Code)
+	}
+
+	// objects in the trash can be held, which excludes them from the purge
+	if rr := request("restic", "DELETE", "/restic/snapshots/"+fileID, ""); rr.Code != http.StatusOK {
+		t.Fatalf("delete snapshot: want %v, got %v", http.StatusOK, rr.Code)
+	}
+	if rr := request("root", "POST", "/_admin/holds/restic", `{"type": "snapshots", "id": "`+fileID+`"}`); rr.Code != http.StatusCreated {
+		t.Fatalf("hold on trashed object: want %v, got %v", http.StatusCreated, rr.Code)
+	}
+	server.purgeTrash(time.Now().Add(2 * time.Hour))
+	if entries, _ := repo.ListTrash(repoDir); len(entries) != 1 {
+		t.Fatalf("held object was purged from the trash: %+v", entries)
+	}
+
+	rr = request("root", "GET", "/_admin/holds/restic", "")
+	var holds []repo.Hold
+	if err := json.NewDecoder(rr.Body).Decode(&holds); err != nil {
+		t.Fatal(err)
+	}
+	if len(holds) != 2 || holds[0].Type != "data" || holds[0].ID != fileID || holds[0].Reason != "case 42" || holds[0].User != "root" {
+		t.Fatalf("unexpected holds %+v", holds)
+	}
+
+	for _, typ := range []string{"data", "snapshots"} {
+		if rr := request("root", "DELETE", "/_admin/holds/restic?type="+typ+"&id="+fileID, ""); rr.Code != http.StatusNoContent {
+			t.Fatalf("release hold: want %v, got %v", http.StatusNoContent, rr.Code)
+		}
+	}
+	if rr := request("root", "DELETE", "/_admin/holds/restic?type=data&id="+fileID, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("release missing hold: want %v, got %v", http.StatusNotFound, rr.Code)
+	}
+	if rr := request("restic", "DELETE", "/restic/data/"+fileID, ""); rr.Code != http.StatusOK {
+		t.Errorf("delete released object: want %v, got %v", http.StatusOK, rr.Code)
+	}
+	server.purgeTrash(time.Now().Add(2 * time.Hour))
+	if entries, _ := repo.ListTrash(repoDir); len(entries) != 0 {
+		t.Fatalf("released object was not purged from the trash: %+v", entries)
+	}
+}
@@ -30,10 +30,12 @@ import (
 	"crypto/subtle"
 	"encoding/base64"
 	"encoding/csv"
+	"errors"
 	"log"
 	"os"
 	"os/signal"
 	"regexp"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -58,14 +60,27 @@ type cacheEntry struct {
 
 // HtpasswdFile is a map for usernames to passwords.
 type HtpasswdFile struct {
-	mutex    sync.Mutex
-	path     string
-	stat     os.FileInfo
-	throttle chan struct{}
-	users    map[string]string
-	cache    map[string]cacheEntry
+	// UpgradeSHA replaces the {SHA} hash of a user with a bcrypt hash in the
+	// htpasswd file after the user logged in successfully.
+	UpgradeSHA bool
+	// RejectSHA refuses logins of users with a {SHA} hash.
+	RejectSHA bool
+
+	mutex      sync.Mutex
+	path       string
+	stat       os.FileInfo
+	throttle   chan struct{}
+	users      map[string]string
+	attributes map[string][]string
+	cache      map[string]cacheEntry
 }
 
+// AttributeAppendOnly marks a user which may only append data to repositories.
+const AttributeAppendOnly = "append-only"
+
+// AttributeAdmin marks a user which may use the admin API.
+const AttributeAdmin = "admin"
+
 // NewHtpasswdFromFile reads the users and passwords from a htpasswd file and returns them.  If an error is encountered,
 // it is returned, together with a nil-Pointer for the HtpasswdFile.
 func NewHtpasswdFromFile(path string) (*HtpasswdFile, error) {
@@ -145,6 +160,8 @@ func (h *HtpasswdFile) Reload() error {
 	cr.Comma = ':'
 	cr.Comment = '#'
 	cr.TrimLeadingSpace = true
+	// entries may contain an optional third field with attributes
+	cr.FieldsPerRecord = -1
 
 	records, err := cr.ReadAll()
 	if err != nil {
@@ -152,12 +169,23 @@ func (h *HtpasswdFile) Reload() error {
 		return err
 	}
 	users := make(map[string]string)
+	attributes := make(map[string][]string)
 	for _, record := range records {
+		if len(record) < 2 {
+			log.Printf("Ignoring htpasswd entry %q without password", record[0])
+			continue
+		}
 		if !validUsernameRegexp.MatchString(record[0]) {
 			log.Printf("Ignoring invalid username %q in htpasswd, consists of characters other than letters, numbers, '_', '-', '.' and '@'", record[0])
 			continue
 		}
+		if !isSupportedHash(record[1]) {
+			log.Printf("WARNING: unsupported password hash format for user %q in htpasswd, this user cannot log in", record[0])
+		}
 		users[record[0]] = record[1]
+		if len(record) > 2 && record[2] != "" {
+			attributes[record[0]] = strings.Split(record[2], ",")
+		}
 	}
 
 	// Replace the Users map
@@ -170,6 +198,7 @@ func (h *HtpasswdFile) Reload() error {
 	h.cache = make(map[string]cacheEntry)
 
 	h.users = users
+	h.attributes = attributes
 	h.mutex.Unlock()
 
 	_ = r.Close()
@@ -211,8 +240,37 @@ func (h *HtpasswdFile) ReloadCheck() error {
 	return nil
 }
 
+// HasAttribute returns true if the htpasswd entry of user lists attribute. The
+// attributes are stored as a comma-separated list in an optional third field,
+// for example "user:$2y$05$...:append-only".
+func (h *HtpasswdFile) HasAttribute(user string, attribute string) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for _, attr := range h.attributes[user] {
+		if attr == attribute {
+			return true
+		}
+	}
+	return false
+}
+
 var shaRe = regexp.MustCompile(`^{SHA}`)
 var bcrRe = regexp.MustCompile(`^\$2b\$|^\$2a\$|^\$2y\$`)
+var md5Re = regexp.MustCompile(`^\$apr1\$|^\$1\$`)
+var shaCryptRe = regexp.MustCompile(`^\$5\$|^\$6\$`)
+var argon2Re = regexp.MustCompile(`^\$argon2id?\$`)
+var scryptRe = regexp.MustCompile(`^\$scrypt\$`)
+
+// isSupportedHash returns true if the format of hashedPassword is known.
+func isSupportedHash(hashedPassword string) bool {
+	for _, re := range []*regexp.Regexp{shaRe, bcrRe, md5Re, shaCryptRe, argon2Re, scryptRe} {
+		if re.MatchString(hashedPassword) {
+			return true
+		}
+	}
+	return false
+}
 
 // Validate returns true if password matches the stored password for user.  If no password for user is stored, or the
 // password is wrong, false is returned.
@@ -236,6 +294,11 @@ func (h *HtpasswdFile) Validate(user string, password string) bool {
 		return false
 	}
 
+	if h.RejectSHA && shaRe.MatchString(hashedPassword) {
+		log.Printf("Rejected login of %s with insecure {SHA} password hash.", user)
+		return false
+	}
+
 	if cacheExists && subtle.ConstantTimeCompare(entry.verifier, hash.Sum(nil)) == 1 {
 		h.mutex.Lock()
 		// repurpose mutex to prevent concurrent cache updates
@@ -255,6 +318,10 @@ func (h *HtpasswdFile) Validate(user string, password string) bool {
 		return false
 	}
 
+	if h.UpgradeSHA && shaRe.MatchString(hashedPassword) {
+		h.upgradeHash(user, hashedPassword, password)
+	}
+
 	h.mutex.Lock()
 	// repurpose mutex to prevent concurrent cache updates
 	cache[user] = cacheEntry{
@@ -266,6 +333,31 @@ func (h *HtpasswdFile) Validate(user string, password string) bool {
 	return true
 }
 
+// upgradeHash replaces the hash of user in the htpasswd file with a bcrypt
+// hash of password, unless the entry was changed in the meantime.
+func (h *HtpasswdFile) upgradeHash(user string, oldHash string, password string) {
+	newHash, err := HashPassword(password)
+	if err != nil {
+		log.Printf("Could not upgrade password hash of %s: %v", user, err)
+		return
+	}
+	err = editHtpasswdFile(h.path, user, func(e *HtpasswdEntry) (*HtpasswdEntry, error) {
+		if e == nil || e.Hash != oldHash {
+			return nil, errors.New("entry changed")
+		}
+		e.Hash = newHash
+		return e, nil
+	})
+	if err != nil {
+		log.Printf("Could not upgrade password hash of %s: %v", user, err)
+		return
+	}
+	if err := h.Reload(); err != nil {
+		log.Printf("Could not reload htpasswd file: %v", err)
+	}
+	log.Printf("Upgraded password hash of %s to bcrypt.", user)
+}
+
 func isMatchingHashAndPassword(hashedPassword string, password string) bool {
 	switch {
 	case shaRe.MatchString(hashedPassword):
@@ -279,6 +371,33 @@ func isMatchingHashAndPassword(hashedPassword string, password string) bool {
 		if err == nil {
 			return true
 		}
+	case md5Re.MatchString(hashedPassword):
+		magic := md5Re.FindString(hashedPassword)
+		computed := md5Crypt([]byte(password), []byte(hashedPassword[len(magic):]), magic)
+		if subtle.ConstantTimeCompare([]byte(computed), []byte(hashedPassword)) == 1 {
+			return true
+		}
+	case shaCryptRe.MatchString(hashedPassword):
+		computed, err := shaCrypt([]byte(password), hashedPassword[3:], hashedPassword[:3])
+		if err != nil {
+			log.Printf("Invalid SHA-crypt hash: %v", err)
+			return false
+		}
+		if subtle.ConstantTimeCompare([]byte(computed), []byte(hashedPassword)) == 1 {
+			return true
+		}
+	case argon2Re.MatchString(hashedPassword):
+		ok, err := verifyArgon2(hashedPassword, password)
+		if err != nil {
+			log.Printf("Invalid argon2 hash: %v", err)
+		}
+		return ok
+	case scryptRe.MatchString(hashedPassword):
+		ok, err := verifyScrypt(hashedPassword, password)
+		if err != nil {
+			log.Printf("Invalid scrypt hash: %v", err)
+		}
+		return ok
 	}
 	return false
 }
@@ -0,0 +1,197 @@
+package restserver
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// HtpasswdEntry is a single user in a htpasswd file.
+type HtpasswdEntry struct {
+	Username   string
+	Hash       string
+	Attributes []string
+}
+
+func (e HtpasswdEntry) String() string {
+	line := e.Username + ":" + e.Hash
+	if len(e.Attributes) > 0 {
+		line += ":" + strings.Join(e.Attributes, ",")
+	}
+	return line
+}
+
+// ValidUsername returns true if name can be used as username in a htpasswd
+// file.
+func ValidUsername(name string) bool {
+	return validUsernameRegexp.MatchString(name)
+}
+
+// HashPassword returns the bcrypt hash of password.
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// parseHtpasswdLine returns the entry for a line of a htpasswd file, or false
+// for empty lines and comments.
+func parseHtpasswdLine(line string) (HtpasswdEntry, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return HtpasswdEntry{}, false
+	}
+	fields := strings.SplitN(line, ":", 3)
+	e := HtpasswdEntry{Username: fields[0]}
+	if len(fields) > 1 {
+		e.Hash = fields[1]
+	}
+	if len(fields) > 2 && fields[2] != "" {
+		e.Attributes = strings.Split(fields[2], ",")
+	}
+	return e, true
+}
+
+// ReadHtpasswdEntries returns all entries of the htpasswd file at path.
+func ReadHtpasswdEntries(path string) ([]HtpasswdEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []HtpasswdEntry
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		if e, ok := parseHtpasswdLine(sc.Text()); ok {
+			entries = append(entries, e)
+		}
+	}
+	return entries, sc.Err()
+}
+
+// ErrUserExists is returned by AddHtpasswdUser if the user already exists.
+var ErrUserExists = errors.New("user already exists")
+
+// validAttribute returns true if attr can be stored as attribute of a user in
+// a htpasswd file.
+func validAttribute(attr string) bool {
+	return attr != "" && !strings.ContainsAny(attr, ":,\n")
+}
+
+// htpasswdEditMutex serializes changes to htpasswd files within the process.
+var htpasswdEditMutex sync.Mutex
+
+// editHtpasswdFile calls edit with the entry of user in the htpasswd file at
+// path, or nil if the user does not exist. The entry returned by edit replaces
+// the existing one, or is appended to the file if the user did not exist
+// before. If edit returns nil, the user is removed. All other lines of the
+// file, including comments, are preserved. The file is replaced atomically and
+// created if it does not exist.
+func editHtpasswdFile(path string, user string, edit func(*HtpasswdEntry) (*HtpasswdEntry, error)) error {
+	htpasswdEditMutex.Lock()
+	defer htpasswdEditMutex.Unlock()
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	var lines []string
+	var current *HtpasswdEntry
+	index := -1
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := sc.Text()
+		if e, ok := parseHtpasswdLine(line); ok && e.Username == user && current == nil {
+			current = &e
+			index = len(lines)
+		}
+		lines = append(lines, line)
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+
+	updated, err := edit(current)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case updated == nil && index >= 0:
+		lines = append(lines[:index], lines[index+1:]...)
+	case updated == nil:
+		return nil
+	case index >= 0:
+		lines[index] = updated.String()
+	default:
+		lines = append(lines, updated.String())
+	}
+
+	var buf bytes.Buffer
+	for _, line := range lines {
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+	return writeFileAtomic(path, buf.Bytes(), 0600)
+}
+
+// AddHtpasswdUser adds a new user with a bcrypt hash of password to the
+// htpasswd file at path.
+func AddHtpasswdUser(path string, user string, password string, attributes []string) error {
+	if !ValidUsername(user) {
+		return fmt.Errorf("invalid username %q, only letters, numbers, '_', '-', '.' and '@' are allowed", user)
+	}
+	for _, attr := range attributes {
+		if !validAttribute(attr) {
+			return fmt.Errorf("invalid attribute %q", attr)
+		}
+	}
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	return editHtpasswdFile(path, user, func(e *HtpasswdEntry) (*HtpasswdEntry, error) {
+		if e != nil {
+			return nil, fmt.Errorf("%w: %s", ErrUserExists, user)
+		}
+		return &HtpasswdEntry{Username: user, Hash: hash, Attributes: attributes}, nil
+	})
+}
+
+// SetHtpasswdPassword replaces the password of an existing user in the
+// htpasswd file at path with a bcrypt hash of password. The attributes of the
+// user are kept.
+func SetHtpasswdPassword(path string, user string, password string) error {
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	return editHtpasswdFile(path, user, func(e *HtpasswdEntry) (*HtpasswdEntry, error) {
+		if e == nil {
+			return nil, fmt.Errorf("user %q does not exist", user)
+		}
+		e.Hash = hash
+		return e, nil
+	})
+}
+
+// RemoveHtpasswdUser removes user from the htpasswd file at path.
+func RemoveHtpasswdUser(path string, user string) error {
+	return editHtpasswdFile(path, user, func(e *HtpasswdEntry) (*HtpasswdEntry, error) {
+		if e == nil {
+			return nil, fmt.Errorf("user %q does not exist", user)
+		}
+		return nil, nil
+	})
+}
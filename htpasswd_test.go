@@ -2,6 +2,8 @@ package restserver
 
 import (
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -43,3 +45,185 @@ func TestValidate(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestAttributes(t *testing.T) {
+	pwd := "$2y$05$z/OEmNQamd6m6LSegUErh.r/Owk9Xwmc5lxDheIuHY2Z7XiS6FtJm"
+	fn := filepath.Join(t.TempDir(), ".htpasswd")
+	content := "admin:" + pwd + "\n" +
+		"backup:" + pwd + ":append-only\n" +
+		"other:" + pwd + ":foo,append-only\n"
+	if err := os.WriteFile(fn, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	htpass, err := NewHtpasswdFromFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for user, want := range map[string]bool{
+		"admin":   false,
+		"backup":  true,
+		"other":   true,
+		"missing": false,
+	} {
+		if got := htpass.HasAttribute(user, AttributeAppendOnly); got != want {
+			t.Errorf("%v: want append-only %v, got %v", user, want, got)
+		}
+	}
+
+	if !htpass.Validate("backup", "test") {
+		t.Error("correct password not accepted for entry with attributes")
+	}
+}
+
+func TestHashFormats(t *testing.T) {
+	var tests = []struct {
+		hash     string
+		password string
+	}{
+		// {SHA} and bcrypt, created using htpasswd -s and htpasswd -B
+		{"{SHA}qUqP5cyxm6YcTAhz05Hph5gvu9M=", "test"},
+		{"$2y$05$z/OEmNQamd6m6LSegUErh.r/Owk9Xwmc5lxDheIuHY2Z7XiS6FtJm", "test"},
+		// created using openssl passwd -apr1 / -1 / -5 / -6 -salt saltsalt test
+		{"$apr1$saltsalt$NBMPZFGR7yazCdGvlWJji1", "test"},
+		{"$1$saltsalt$tTWg0JeO/sYmHvtKmZE8c.", "test"},
+		{"$5$saltsalt$q6kNPzk9GPb3dpYKO2TUS45z2kiVxsUVz7eWVJcih.0", "test"},
+		{"$6$saltsalt$JcVDtuB6d1BHhCd5RPBh8g8xX/1CbY8EU2PN0MTaj2/Mypw4P./C6dN4j0HALhzBDTocyW1Jm.gYaTPjFGCV40", "test"},
+		// salt longer than 16 characters is truncated
+		{"$5$toolongsaltstrin$ejiGtQrc9V16kN0ynauD5Lf0BnCBf8kvuOeTSzpsOFA", "test"},
+		// created using crypt(3) from glibc with custom rounds
+		{"$5$rounds=10000$saltstringsaltst$wHcAz1drALV3jcH3QrFdQ0UZ5xZ.utL8dXX.Mr9ilk3", "test"},
+		{"$6$rounds=1000$abc$HIrB3HxYtjluvXN52jI4i5PmbRYjGOQyiH3E9Gaw/1g16mZ9SKDrtrD93kj01C9iGf1Py7T5./4LN6sCyy3yU/", "test"},
+		{"$6$xyz$8/OK92t3.kf9i9gVxQZae2eoGjYq3BcjHocvDFGMQz8pd9Bj.0wGEZHEU5H0PwTQW1RsUH3rtzCLDorIjD2OK/", "a much longer password that exceeds sixty four bytes in length, really it does"},
+		// test vectors from the argon2 reference implementation
+		{"$argon2i$v=19$m=65536,t=2,p=4$c29tZXNhbHQ$RdescudvJCsgt3ub+b+dWRWJTmaaJObG", "password"},
+		{"$argon2id$v=19$m=65536,t=2,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc", "password"},
+		// created using hashlib.scrypt from Python
+		{"$scrypt$ln=14,r=8,p=1$MDEyMzQ1Njc4OWFiY2RlZg$Nb+CrdPpamPozpkiW4HbOaeq726iWjhjKj0njlfCwjA", "test"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.hash[:8], func(t *testing.T) {
+			if !isSupportedHash(test.hash) {
+				t.Errorf("hash format of %v not supported", test.hash)
+			}
+			if !isMatchingHashAndPassword(test.hash, test.password) {
+				t.Errorf("correct password not accepted for %v", test.hash)
+			}
+			if isMatchingHashAndPassword(test.hash, test.password+"x") {
+				t.Errorf("wrong password accepted for %v", test.hash)
+			}
+		})
+	}
+
+	for _, hash := range []string{"plaintext", "$7$CU..../....", "$argon2id$v=19$broken"} {
+		if isMatchingHashAndPassword(hash, "test") {
+			t.Errorf("password accepted for unsupported hash %v", hash)
+		}
+	}
+}
+
+func TestEditHtpasswd(t *testing.T) {
+	pwd := "$2y$05$z/OEmNQamd6m6LSegUErh.r/Owk9Xwmc5lxDheIuHY2Z7XiS6FtJm"
+	fn := filepath.Join(t.TempDir(), ".htpasswd")
+	if err := os.WriteFile(fn, []byte("# comment\nold:"+pwd+":append-only\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := AddHtpasswdUser(fn, "new", "secret", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddHtpasswdUser(fn, "new", "secret", nil); err == nil {
+		t.Error("adding an existing user did not fail")
+	}
+	if err := AddHtpasswdUser(fn, "in:valid", "secret", nil); err == nil {
+		t.Error("invalid username accepted")
+	}
+	if err := SetHtpasswdPassword(fn, "old", "changed"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetHtpasswdPassword(fn, "missing", "changed"); err == nil {
+		t.Error("changing the password of a missing user did not fail")
+	}
+
+	htpass, err := NewHtpasswdFromFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !htpass.Validate("new", "secret") || !htpass.Validate("old", "changed") || htpass.Validate("old", "test") {
+		t.Error("passwords were not updated")
+	}
+	if !htpass.HasAttribute("old", AttributeAppendOnly) {
+		t.Error("attributes were not preserved")
+	}
+
+	if err := RemoveHtpasswdUser(fn, "old"); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := ReadHtpasswdEntries(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Username != "new" {
+		t.Errorf("unexpected entries after removal: %v", entries)
+	}
+	data, err := os.ReadFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "# comment\n") {
+		t.Errorf("comment was not preserved: %q", data)
+	}
+}
+
+func TestUpgradeSHA(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), ".htpasswd")
+	content := "# legacy users\nold:{SHA}qUqP5cyxm6YcTAhz05Hph5gvu9M=:append-only\nother:{SHA}qUqP5cyxm6YcTAhz05Hph5gvu9M=\n"
+	if err := os.WriteFile(fn, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	htpass, err := NewHtpasswdFromFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	htpass.UpgradeSHA = true
+
+	if htpass.Validate("old", "wrong") {
+		t.Fatal("wrong password accepted")
+	}
+	if !htpass.Validate("old", "test") {
+		t.Fatal("correct password not accepted")
+	}
+
+	entries, err := ReadHtpasswdEntries(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bcrRe.MatchString(entries[0].Hash) || len(entries[0].Attributes) != 1 {
+		t.Errorf("entry was not upgraded to bcrypt: %v", entries[0])
+	}
+	if entries[1].Hash != "{SHA}qUqP5cyxm6YcTAhz05Hph5gvu9M=" {
+		t.Errorf("other entry was changed: %v", entries[1])
+	}
+	data, err := os.ReadFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "# legacy users\n") {
+		t.Errorf("comment was not preserved: %q", data)
+	}
+	if !htpass.Validate("old", "test") {
+		t.Error("upgraded password not accepted")
+	}
+
+	// once the migration is over, {SHA} hashes are rejected
+	htpass.RejectSHA = true
+	if htpass.Validate("other", "test") {
+		t.Error("{SHA} password accepted")
+	}
+	if !htpass.Validate("old", "test") {
+		t.Error("upgraded password not accepted")
+	}
+}
@@ -0,0 +1,118 @@
+package restserver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/restic/rest-server/repo"
+)
+
+func TestDataPaths(t *testing.T) {
+	extra := t.TempDir()
+	server := &Server{
+		NoAuth:       true,
+		DataPaths:    []string{extra},
+		PanicOnError: true,
+	}
+	mux, _, _, tempdir, cleanup := createTestHandler(t, server)
+	defer cleanup()
+
+	checkRequest(t, mux.ServeHTTP, newRequest(t, "POST", "/?create=true", nil), []wantFunc{wantCode(http.StatusOK)})
+
+	var ids []string
+	data := make(map[string]string)
+	for i := 0; i < 16; i++ {
+		content := fmt.Sprintf("data file %d", i)
+		hash := sha256.Sum256([]byte(content))
+		id := hex.EncodeToString(hash[:])
+		ids = append(ids, id)
+		data[id] = content
+		checkRequest(t, mux.ServeHTTP, newRequest(t, "POST", "/data/"+id, strings.NewReader(content)), []wantFunc{wantCode(http.StatusOK)})
+	}
+	sort.Strings(ids)
+
+	// the data files are spread across both directories
+	counts := make(map[string]int)
+	for _, dir := range []string{tempdir, extra} {
+		for _, id := range ids {
+			if _, err := os.Stat(filepath.Join(dir, "data", id[:2], id)); err == nil {
+				counts[dir]++
+			}
+		}
+	}
+	if counts[tempdir] == 0 || counts[extra] == 0 || counts[tempdir]+counts[extra] != len(ids) {
+		t.Fatalf("data files are not spread across the directories: %v", counts)
+	}
+
+	for _, id := range ids {
+		checkRequest(t, mux.ServeHTTP, newRequest(t, "GET", "/data/"+id, nil), []wantFunc{wantCode(http.StatusOK), wantBody(data[id])})
+		checkRequest(t, mux.ServeHTTP, newRequest(t, "HEAD", "/data/"+id, nil), []wantFunc{wantCode(http.StatusOK)})
+	}
+	checkRequest(t, mux.ServeHTTP, newRequest(t, "GET", "/data/", nil), []wantFunc{wantCode(http.StatusOK), wantBody(`["` + strings.Join(ids, `","`) + `"]`)})
+
+	// holds can be placed on data files in all directories
+	for _, id := range ids {
+		if _, err := repo.PlaceHold(server.storage, tempdir, repo.Hold{Type: "data", ID: id}); err != nil {
+			t.Fatalf("cannot place hold on %v: %v", id, err)
+		}
+		if _, err := repo.ReleaseHold(tempdir, "data", id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, id := range ids {
+		checkRequest(t, mux.ServeHTTP, newRequest(t, "DELETE", "/data/"+id, nil), []wantFunc{wantCode(http.StatusOK)})
+		checkRequest(t, mux.ServeHTTP, newRequest(t, "GET", "/data/"+id, nil), []wantFunc{wantCode(http.StatusNotFound)})
+	}
+	checkRequest(t, mux.ServeHTTP, newRequest(t, "GET", "/data/", nil), []wantFunc{wantCode(http.StatusOK), wantBody(`[]`)})
+
+	// only data files are stored in other directories, even if the path of
+	// the repository looks like a data directory
+	for _, name := range []string{"config", strings.Repeat("cd", 32)} {
+		tf, err := server.storage.Create(filepath.Join(tempdir, "data", "ab", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tf.Write([]byte("config")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tf.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(filepath.Join(tempdir, "data", "ab", name)); err != nil {
+			t.Errorf("%v is not stored in the first directory: %v", name, err)
+		}
+	}
+
+	if _, err := NewHandler(&Server{NoAuth: true, Path: tempdir, DataPaths: []string{extra}, TrashRetention: 1}); err == nil {
+		t.Error("multiple data directories with trash did not fail")
+	}
+}
+
+func TestDataPathsQuota(t *testing.T) {
+	// the quota covers the files in all data directories
+	extra := t.TempDir()
+	if err := os.WriteFile(filepath.Join(extra, "file"), make([]byte, 1000), 0600); err != nil {
+		t.Fatal(err)
+	}
+	mux, data, fileID, _, cleanup := createTestHandler(t, &Server{
+		NoAuth:       true,
+		DataPaths:    []string{extra},
+		MaxRepoSize:  1024,
+		PanicOnError: true,
+	})
+	defer cleanup()
+
+	checkRequest(t, mux.ServeHTTP, newRequest(t, "POST", "/?create=true", nil), []wantFunc{wantCode(http.StatusOK)})
+	req := newRequest(t, "POST", "/data/"+fileID, strings.NewReader(data))
+	req.Header.Set("Content-Length", strconv.Itoa(len(data)))
+	checkRequest(t, mux.ServeHTTP, req, []wantFunc{wantCode(http.StatusInsufficientStorage)})
+}
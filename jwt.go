@@ -0,0 +1,424 @@
+package restserver
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JWTClockSkew is the tolerance when checking the expiry and not-before times
+// of a JSON Web Token.
+const JWTClockSkew = time.Minute
+
+// jsonWebKey is a single key from a JWKS file, see RFC 7517.
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA keys
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC and OKP keys
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// verificationKey is a public key loaded from a JWKS file.
+type verificationKey struct {
+	alg string // if set, the key must only be used with this algorithm
+	key crypto.PublicKey
+}
+
+// JWTVerifier validates JSON Web Tokens using the public keys from a JWKS file.
+// The username and, optionally, the repositories a user may access are taken
+// from the claims of the token.
+type JWTVerifier struct {
+	// Issuer and Audience must match the iss and aud claims if set.
+	Issuer   string
+	Audience string
+	// UsernameClaim is the claim which contains the username.
+	UsernameClaim string
+	// ReposClaim, if set, is the claim which lists the repository path
+	// prefixes the user may access.
+	ReposClaim string
+
+	mutex sync.Mutex
+	file  *watchedFile
+	keys  map[string]verificationKey // indexed by key ID
+}
+
+// NewJWTVerifierFromFile loads the JWKS file at path. The file is reloaded
+// when it changes on disk or when the process receives SIGHUP.
+func NewJWTVerifierFromFile(path string) (*JWTVerifier, error) {
+	file, err := newWatchedFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &JWTVerifier{
+		UsernameClaim: "sub",
+		file:          file,
+	}
+	if err := v.Reload(); err != nil {
+		return nil, err
+	}
+
+	reloadOnSIGHUP("JWKS file", v.Reload)
+
+	return v, nil
+}
+
+// Reload reloads the JWKS file. If the file cannot be parsed, the previous
+// keys are kept and the error is returned.
+func (v *JWTVerifier) Reload() error {
+	data, err := os.ReadFile(v.file.path)
+	if err != nil {
+		return err
+	}
+
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return fmt.Errorf("%s: %w", v.file.path, err)
+	}
+
+	keys := make(map[string]verificationKey)
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			log.Printf("Ignoring key %q in JWKS file: %v", jwk.Kid, err)
+			continue
+		}
+		keys[jwk.Kid] = verificationKey{alg: jwk.Alg, key: key}
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("%s: no usable keys found", v.file.path)
+	}
+
+	v.mutex.Lock()
+	v.keys = keys
+	v.mutex.Unlock()
+	return nil
+}
+
+// ReloadCheck reloads the JWKS file if it changed on disk.
+func (v *JWTVerifier) ReloadCheck() {
+	if !v.file.changed() {
+		return
+	}
+	if err := v.Reload(); err != nil {
+		log.Printf("Could not reload JWKS file: %v", err)
+		return
+	}
+	log.Printf("Reloaded JWKS file")
+}
+
+func decodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	buf, err := decodeBase64URL(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) == 0 {
+		return nil, errors.New("empty value")
+	}
+	return new(big.Int).SetBytes(buf), nil
+}
+
+// publicKey returns the public key described by jwk.
+func (jwk jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeBigInt(jwk.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus: %w", err)
+		}
+		e, err := decodeBigInt(jwk.E)
+		if err != nil || !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid exponent")
+		}
+		if n.BitLen() < 2048 {
+			return nil, fmt.Errorf("RSA key too short (%d bits)", n.BitLen())
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		var ecdhCurve ecdh.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve, ecdhCurve = elliptic.P256(), ecdh.P256()
+		case "P-384":
+			curve, ecdhCurve = elliptic.P384(), ecdh.P384()
+		case "P-521":
+			curve, ecdhCurve = elliptic.P521(), ecdh.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := decodeBase64URL(jwk.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x coordinate: %w", err)
+		}
+		y, err := decodeBase64URL(jwk.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y coordinate: %w", err)
+		}
+		size := (curve.Params().BitSize + 7) / 8
+		if len(x) != size || len(y) != size {
+			return nil, errors.New("invalid coordinate length")
+		}
+		// let crypto/ecdh check that the point is on the curve
+		point := append(append([]byte{4}, x...), y...)
+		if _, err := ecdhCurve.NewPublicKey(point); err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := decodeBase64URL(jwk.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid public key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+}
+
+// looksLikeJWT returns true if token has the structure of a JSON Web Token.
+func looksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// Validate checks the signature and claims of token and returns the identity
+// of the user.
+func (v *JWTVerifier) Validate(token string) (identity, bool) {
+	v.ReloadCheck()
+
+	claims, err := v.verify(token, time.Now())
+	if err != nil {
+		log.Printf("Invalid JWT: %v", err)
+		return identity{}, false
+	}
+
+	username, _ := claims[v.UsernameClaim].(string)
+	if username == "" {
+		log.Printf("Invalid JWT: claim %q is missing", v.UsernameClaim)
+		return identity{}, false
+	}
+	if !ValidUsername(username) {
+		log.Printf("Invalid JWT: claim %q contains the invalid username %q", v.UsernameClaim, username)
+		return identity{}, false
+	}
+	id := identity{username: username, access: AccessFull}
+
+	if v.ReposClaim != "" {
+		switch repos := claims[v.ReposClaim].(type) {
+		case string:
+			id.repos = strings.Fields(repos)
+		case []interface{}:
+			for _, repo := range repos {
+				if s, ok := repo.(string); ok {
+					id.repos = append(id.repos, s)
+				}
+			}
+		}
+		if len(id.repos) == 0 {
+			// without this claim, the user must not have access to all repositories
+			log.Printf("Invalid JWT for %s: claim %q is missing", username, v.ReposClaim)
+			return identity{}, false
+		}
+	}
+	return id, true
+}
+
+// verify checks the signature of token and the registered claims, and returns
+// all claims.
+func (v *JWTVerifier) verify(token string, now time.Time) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	buf, err := decodeBase64URL(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid header: %w", err)
+	}
+	if err := json.Unmarshal(buf, &header); err != nil {
+		return nil, fmt.Errorf("invalid header: %w", err)
+	}
+
+	v.mutex.Lock()
+	key, ok := v.keys[header.Kid]
+	if !ok && header.Kid == "" && len(v.keys) == 1 {
+		for _, k := range v.keys {
+			key, ok = k, true
+		}
+	}
+	v.mutex.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", header.Kid)
+	}
+	if key.alg != "" && key.alg != header.Alg {
+		return nil, fmt.Errorf("algorithm %q not allowed for key %q", header.Alg, header.Kid)
+	}
+
+	signature, err := decodeBase64URL(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature: %w", err)
+	}
+	if err := verifySignature(header.Alg, key.key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+
+	buf, err = decodeBase64URL(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid claims: %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	var claims map[string]interface{}
+	if err := dec.Decode(&claims); err != nil {
+		return nil, fmt.Errorf("invalid claims: %w", err)
+	}
+
+	exp, ok := numericDate(claims["exp"])
+	if !ok {
+		return nil, errors.New("claim exp is missing")
+	}
+	if !now.Before(exp.Add(JWTClockSkew)) {
+		return nil, errors.New("token has expired")
+	}
+	if nbf, ok := numericDate(claims["nbf"]); ok && now.Add(JWTClockSkew).Before(nbf) {
+		return nil, errors.New("token is not valid yet")
+	}
+	if v.Issuer != "" && claims["iss"] != v.Issuer {
+		return nil, fmt.Errorf("wrong issuer %v", claims["iss"])
+	}
+	if v.Audience != "" && !hasAudience(claims["aud"], v.Audience) {
+		return nil, fmt.Errorf("wrong audience %v", claims["aud"])
+	}
+	return claims, nil
+}
+
+// numericDate converts a NumericDate claim to a time.
+func numericDate(claim interface{}) (time.Time, bool) {
+	n, ok := claim.(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(f), 0), true
+}
+
+// hasAudience returns true if the aud claim, which is either a string or a
+// list of strings, contains audience.
+func hasAudience(claim interface{}, audience string) bool {
+	switch aud := claim.(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, a := range aud {
+			if a == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// verifySignature checks the signature of a JSON Web Signature, see RFC 7518.
+func verifySignature(alg string, key crypto.PublicKey, signed, signature []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "PS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "PS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "PS512", "ES512":
+		hash = crypto.SHA512
+	case "EdDSA":
+		pub, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return fmt.Errorf("algorithm %s requires an Ed25519 key", alg)
+		}
+		if !ed25519.Verify(pub, signed, signature) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+
+	h := hash.New()
+	_, _ = h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch alg[:2] {
+	case "RS", "PS":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("algorithm %s requires an RSA key", alg)
+		}
+		var err error
+		if alg[0] == 'R' {
+			err = rsa.VerifyPKCS1v15(pub, hash, digest, signature)
+		} else {
+			err = rsa.VerifyPSS(pub, hash, digest, signature, nil)
+		}
+		if err != nil {
+			return errors.New("invalid signature")
+		}
+	case "ES":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("algorithm %s requires an EC key", alg)
+		}
+		bits := map[string]int{"ES256": 256, "ES384": 384, "ES512": 521}[alg]
+		if pub.Curve.Params().BitSize != bits {
+			return fmt.Errorf("algorithm %s does not match the curve of the key", alg)
+		}
+		size := (bits + 7) / 8
+		if len(signature) != 2*size {
+			return errors.New("invalid signature")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return errors.New("invalid signature")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+package restserver
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func b64(buf []byte) string {
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// signJWT creates a JSON Web Token with the given claims.
+func signJWT(t testing.TB, alg, kid string, key crypto.Signer, claims map[string]interface{}) string {
+	header, err := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := b64(header) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(k, []byte(signed))
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	case *rsa.PrivateKey:
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return signed + "." + b64(sig)
+}
+
+func writeTestJWKS(t testing.TB) (string, *ecdsa.PrivateKey, ed25519.PrivateKey, *rsa.PrivateKey) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwks := map[string]interface{}{
+		"keys": []map[string]string{
+			{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+			{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": b64(edPub), "alg": "EdDSA"},
+			{"kty": "RSA", "kid": "rsa", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes()), "use": "sig"},
+			{"kty": "RSA", "kid": "enc", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes()), "use": "enc"},
+		},
+	}
+	data, err := json.Marshal(jwks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(fn, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return fn, ecKey, edKey, rsaKey
+}
+
+func TestJWTVerifier(t *testing.T) {
+	fn, ecKey, edKey, rsaKey := writeTestJWKS(t)
+
+	v, err := NewJWTVerifierFromFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.Issuer = "https://idp.example.com"
+	v.Audience = "rest-server"
+	v.ReposClaim = "repos"
+
+	now := time.Now()
+	claims := func(modify func(map[string]interface{})) map[string]interface{} {
+		c := map[string]interface{}{
+			"sub":   "alice",
+			"iss":   "https://idp.example.com",
+			"aud":   []string{"other", "rest-server"},
+			"exp":   now.Add(time.Hour).Unix(),
+			"repos": []string{"/alice", "/shared"},
+		}
+		if modify != nil {
+			modify(c)
+		}
+		return c
+	}
+
+	var tests = []struct {
+		token string
+		valid bool
+	}{
+		{signJWT(t, "ES256", "ec", ecKey, claims(nil)), true},
+		{signJWT(t, "EdDSA", "ed", edKey, claims(nil)), true},
+		{signJWT(t, "RS256", "rsa", rsaKey, claims(nil)), true},
+		// wrong key for kid
+		{signJWT(t, "ES256", "rsa", ecKey, claims(nil)), false},
+		// key not meant for signatures
+		{signJWT(t, "RS256", "enc", rsaKey, claims(nil)), false},
+		// unknown key
+		{signJWT(t, "ES256", "other", ecKey, claims(nil)), false},
+		// algorithm not allowed for the key
+		{signJWT(t, "ES256", "ed", ecKey, claims(nil)), false},
+		{signJWT(t, "ES256", "ec", ecKey, claims(func(c map[string]interface{}) { c["exp"] = now.Add(-time.Hour).Unix() })), false},
+		{signJWT(t, "ES256", "ec", ecKey, claims(func(c map[string]interface{}) { delete(c, "exp") })), false},
+		{signJWT(t, "ES256", "ec", ecKey, claims(func(c map[string]interface{}) { c["nbf"] = now.Add(time.Hour).Unix() })), false},
+		{signJWT(t, "ES256", "ec", ecKey, claims(func(c map[string]interface{}) { c["iss"] = "https://evil.example.com" })), false},
+		{signJWT(t, "ES256", "ec", ecKey, claims(func(c map[string]interface{}) { c["aud"] = "other" })), false},
+		{signJWT(t, "ES256", "ec", ecKey, claims(func(c map[string]interface{}) { delete(c, "sub") })), false},
+		{signJWT(t, "ES256", "ec", ecKey, claims(func(c map[string]interface{}) { c["sub"] = "../alice" })), false},
+		{signJWT(t, "ES256", "ec", ecKey, claims(func(c map[string]interface{}) { delete(c, "repos") })), false},
+		{"invalid.jwt.token", false},
+	}
+
+	for i, test := range tests {
+		id, ok := v.Validate(test.token)
+		if ok != test.valid {
+			t.Errorf("test %d: want valid %v, got %v", i, test.valid, ok)
+			continue
+		}
+		if ok && (id.username != "alice" || strings.Join(id.repos, " ") != "/alice /shared") {
+			t.Errorf("test %d: wrong identity %+v", i, id)
+		}
+	}
+
+	// tampering with the claims must invalidate the signature
+	token := signJWT(t, "ES256", "ec", ecKey, claims(nil))
+	parts := strings.Split(token, ".")
+	payload, _ := json.Marshal(claims(func(c map[string]interface{}) { c["sub"] = "mallory" }))
+	if _, ok := v.Validate(parts[0] + "." + b64(payload) + "." + parts[2]); ok {
+		t.Error("token with modified claims accepted")
+	}
+}
+
+func TestJWTHandler(t *testing.T) {
+	fn, ecKey, _, _ := writeTestJWKS(t)
+
+	mux, _, _, _, cleanup := createTestHandler(t, &Server{
+		JWKSPath:     fn,
+		PrivateRepos: true,
+		PanicOnError: true,
+	})
+	defer cleanup()
+
+	token := signJWT(t, "ES256", "ec", ecKey, map[string]interface{}{
+		"sub": "alice",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+
+	for path, code := range map[string]int{
+		"/alice/?create=true": http.StatusOK,
+		"/bob/?create=true":   http.StatusUnauthorized,
+	} {
+		req := newRequest(t, "POST", path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		checkRequest(t, mux.ServeHTTP, req, []wantFunc{wantCode(code)})
+	}
+}
+
+func TestJWTAppendOnlyUser(t *testing.T) {
+	fn, ecKey, _, _ := writeTestJWKS(t)
+	htpasswd := filepath.Join(t.TempDir(), ".htpasswd")
+	pwd := "$2y$05$z/OEmNQamd6m6LSegUErh.r/Owk9Xwmc5lxDheIuHY2Z7XiS6FtJm"
+	if err := os.WriteFile(htpasswd, []byte("backup:"+pwd+":append-only,admin\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	htpass, err := NewHtpasswdFromFile(htpasswd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := NewJWTVerifierFromFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.ReposClaim = "repos"
+	server := &Server{htpasswdFile: htpass, jwtVerifier: v}
+
+	// the attributes in the htpasswd file apply to users authenticated by a JWT
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+signJWT(t, "ES256", "ec", ecKey, map[string]interface{}{
+		"sub":   "backup",
+		"repos": "/backup",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}))
+	id, ok := server.checkAuth(req)
+	if !ok {
+		t.Fatal("authentication failed")
+	}
+	if id.access != AccessAppend {
+		t.Errorf("want access %v, got %v", AccessAppend, id.access)
+	}
+	if len(id.repos) != 1 || id.repos[0] != "/backup" {
+		t.Errorf("wrong repositories %v", id.repos)
+	}
+	if id.admin {
+		t.Error("JWT was granted admin access")
+	}
+}
@@ -0,0 +1,166 @@
+package restserver
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// failureCounter tracks the failed authentication attempts of a single remote
+// IP or username.
+type failureCounter struct {
+	failures    int
+	first       time.Time // time of the first failure in the current window
+	lockedUntil time.Time
+}
+
+// maxFailureCounters limits the number of remote IPs and usernames with
+// recent failures which are tracked, as both are chosen by the client. Once the
+// limit is reached, failures of further IPs or usernames are not counted until
+// older entries expire.
+const maxFailureCounters = 10000
+
+// loginThrottle counts failed authentication attempts per remote IP and per
+// username. Once a client exceeds the configured number of failures within
+// window, further attempts are rejected until the lockout expires, without
+// checking the credentials.
+type loginThrottle struct {
+	maxPerIP   int // 0 disables the limit
+	maxPerUser int // 0 disables the limit
+	window     time.Duration
+	lockout    time.Duration
+
+	mutex sync.Mutex
+	ips   map[string]*failureCounter
+	users map[string]*failureCounter
+}
+
+func newLoginThrottle(maxPerIP, maxPerUser int, window, lockout time.Duration) *loginThrottle {
+	t := &loginThrottle{
+		maxPerIP:   maxPerIP,
+		maxPerUser: maxPerUser,
+		window:     window,
+		lockout:    lockout,
+		ips:        make(map[string]*failureCounter),
+		users:      make(map[string]*failureCounter),
+	}
+	go t.cleanupTimer()
+	return t
+}
+
+// cleanupTimer periodically removes expired counters.
+func (t *loginThrottle) cleanupTimer() {
+	for {
+		time.Sleep(time.Minute)
+		t.cleanup(time.Now())
+	}
+}
+
+func (t *loginThrottle) cleanup(now time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.expire(t.ips, now)
+	t.expire(t.users, now)
+}
+
+// expire removes the counters which are neither locked out nor within the
+// window. The caller must hold t.mutex.
+func (t *loginThrottle) expire(counters map[string]*failureCounter, now time.Time) {
+	for key, c := range counters {
+		if !now.Before(c.lockedUntil) && now.Sub(c.first) > t.window {
+			delete(counters, key)
+		}
+	}
+}
+
+// updateMetrics sets the number of currently locked out IPs and users. It is
+// called before the metrics are collected, so that expired lockouts are not
+// reported.
+func (t *loginThrottle) updateMetrics(now time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for scope, counters := range map[string]map[string]*failureCounter{"ip": t.ips, "user": t.users} {
+		locked := 0
+		for _, c := range counters {
+			if now.Before(c.lockedUntil) {
+				locked++
+			}
+		}
+		metricAuthLockedOut.WithLabelValues(scope).Set(float64(locked))
+	}
+}
+
+// retryAfter returns the remaining lockout time for ip or user, or zero if
+// neither is locked out. user may be empty if it is not known.
+func (t *loginThrottle) retryAfter(ip, user string, now time.Time) time.Duration {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var retry time.Duration
+	if c, ok := t.ips[ip]; ok && now.Before(c.lockedUntil) {
+		retry = c.lockedUntil.Sub(now)
+	}
+	if c, ok := t.users[user]; ok && user != "" && now.Before(c.lockedUntil) {
+		retry = max(retry, c.lockedUntil.Sub(now))
+	}
+	return retry
+}
+
+// fail records a failed authentication attempt.
+func (t *loginThrottle) fail(ip, user string, now time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	metricAuthFailuresTotal.Inc()
+	if t.maxPerIP > 0 {
+		t.count(t.ips, ip, t.maxPerIP, "ip", now)
+	}
+	if t.maxPerUser > 0 && user != "" {
+		t.count(t.users, user, t.maxPerUser, "user", now)
+	}
+}
+
+// count increments the failure counter for key and locks it out once limit is
+// reached. The caller must hold t.mutex.
+func (t *loginThrottle) count(counters map[string]*failureCounter, key string, limit int, scope string, now time.Time) {
+	c, ok := counters[key]
+	if !ok && len(counters) >= maxFailureCounters {
+		t.expire(counters, now)
+		if len(counters) >= maxFailureCounters {
+			return
+		}
+	}
+	if !ok || now.Sub(c.first) > t.window {
+		c = &failureCounter{first: now}
+		counters[key] = c
+	}
+	c.failures++
+	if c.failures >= limit && !now.Before(c.lockedUntil) {
+		c.lockedUntil = now.Add(t.lockout)
+		c.failures = 0
+		c.first = now
+		metricAuthLockoutsTotal.WithLabelValues(scope).Inc()
+	}
+}
+
+// succeed resets the failure counter of user after a successful login.
+func (t *loginThrottle) succeed(user string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if c, ok := t.users[user]; ok && !time.Now().Before(c.lockedUntil) {
+		delete(t.users, user)
+	}
+}
+
+// remoteIP returns the IP address of the client which sent r.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,154 @@
+package restserver
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestLoginThrottle(t *testing.T) {
+	throttle := newLoginThrottle(5, 3, time.Minute, 10*time.Minute)
+	now := time.Now()
+
+	// failures for different users from the same IP
+	for i := 0; i < 4; i++ {
+		throttle.fail("192.0.2.1", "user", now)
+	}
+	if retry := throttle.retryAfter("192.0.2.1", "other", now); retry != 0 {
+		t.Fatalf("IP locked out too early, retry after %v", retry)
+	}
+	if retry := throttle.retryAfter("192.0.2.2", "user", now); retry != 10*time.Minute {
+		t.Fatalf("user not locked out, retry after %v", retry)
+	}
+
+	throttle.fail("192.0.2.1", "", now)
+	if retry := throttle.retryAfter("192.0.2.1", "other", now); retry != 10*time.Minute {
+		t.Fatalf("IP not locked out, retry after %v", retry)
+	}
+	if retry := throttle.retryAfter("192.0.2.1", "other", now.Add(11*time.Minute)); retry != 0 {
+		t.Fatalf("lockout did not expire, retry after %v", retry)
+	}
+
+	// failures outside of the window are forgotten
+	for i := 0; i < 3; i++ {
+		throttle.fail("192.0.2.3", "slow", now.Add(time.Duration(i)*2*time.Minute))
+	}
+	if retry := throttle.retryAfter("192.0.2.3", "slow", now.Add(4*time.Minute)); retry != 0 {
+		t.Fatalf("user locked out for failures outside the window, retry after %v", retry)
+	}
+
+	throttle.updateMetrics(now)
+	if locked := lockedOutUsers(t); locked != 1 {
+		t.Errorf("want 1 locked out user, got %v", locked)
+	}
+	throttle.updateMetrics(now.Add(11 * time.Minute))
+	if locked := lockedOutUsers(t); locked != 0 {
+		t.Errorf("expired lockout still reported, got %v locked out users", locked)
+	}
+
+	throttle.cleanup(now.Add(time.Hour))
+	if len(throttle.ips) != 0 || len(throttle.users) != 0 {
+		t.Fatalf("expired counters not removed: %v %v", throttle.ips, throttle.users)
+	}
+
+	// the number of tracked usernames is limited
+	for i := 0; i < maxFailureCounters+10; i++ {
+		throttle.fail("192.0.2.4", fmt.Sprintf("user%d", i), now)
+	}
+	if len(throttle.users) != maxFailureCounters {
+		t.Errorf("want %v tracked users, got %v", maxFailureCounters, len(throttle.users))
+	}
+	throttle.fail("192.0.2.4", "late", now.Add(time.Hour))
+	if _, ok := throttle.users["late"]; !ok {
+		t.Error("expired counters were not removed for a new user")
+	}
+}
+
+func TestLoginThrottleHandler(t *testing.T) {
+	dir := t.TempDir()
+	htpasswd := filepath.Join(dir, ".htpasswd")
+	pwd := "$2y$05$z/OEmNQamd6m6LSegUErh.r/Owk9Xwmc5lxDheIuHY2Z7XiS6FtJm"
+	if err := os.WriteFile(htpasswd, []byte("restic:"+pwd+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	mux, _, _, _, cleanup := createTestHandler(t, &Server{
+		HtpasswdPath:        htpasswd,
+		MaxAuthFailuresUser: 3,
+		AuthFailureWindow:   time.Minute,
+		AuthLockout:         time.Minute,
+	})
+	defer cleanup()
+
+	request := func(password string) *http.Request {
+		req := newRequest(t, "GET", "/config", nil)
+		req.SetBasicAuth("restic", password)
+		return req
+	}
+
+	checkRequest(t, mux.ServeHTTP, request("test"), []wantFunc{wantCode(http.StatusNotFound)})
+	// requests without credentials are not counted
+	for i := 0; i < 3; i++ {
+		checkRequest(t, mux.ServeHTTP, newRequest(t, "GET", "/config", nil), []wantFunc{wantCode(http.StatusUnauthorized)})
+	}
+	checkRequest(t, mux.ServeHTTP, request("test"), []wantFunc{wantCode(http.StatusNotFound)})
+	for i := 0; i < 3; i++ {
+		checkRequest(t, mux.ServeHTTP, request("wrong"), []wantFunc{wantCode(http.StatusUnauthorized)})
+	}
+
+	// the correct password is rejected during the lockout
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, request("test"))
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("wrong response code, want %v, got %v", http.StatusTooManyRequests, rr.Code)
+	}
+	if rr.Header().Get("Retry-After") == "" {
+		t.Error("Retry-After header is missing")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	proxies, err := parseTrustedProxies([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		proxies   *trustedProxies
+		remote    string
+		forwarded string
+		want      string
+	}{
+		{nil, "10.0.0.1:1234", "192.0.2.1", "10.0.0.1"},
+		{proxies, "10.0.0.1:1234", "", "10.0.0.1"},
+		{proxies, "10.0.0.1:1234", "192.0.2.1", "192.0.2.1"},
+		// entries added by the client cannot be trusted
+		{proxies, "10.0.0.1:1234", "198.51.100.1, 192.0.2.1, 10.0.0.2", "192.0.2.1"},
+		// the header is ignored for requests not received from a proxy
+		{proxies, "192.0.2.2:1234", "192.0.2.1", "192.0.2.2"},
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = test.remote
+		if test.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", test.forwarded)
+		}
+		if got := test.proxies.clientIP(req); got != test.want {
+			t.Errorf("%v %q: want %v, got %v", test.remote, test.forwarded, test.want, got)
+		}
+	}
+}
+
+// lockedOutUsers returns the current value of the locked out users metric.
+func lockedOutUsers(t *testing.T) float64 {
+	var m dto.Metric
+	if err := metricAuthLockedOut.WithLabelValues("user").Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetGauge().GetValue()
+}
@@ -0,0 +1,64 @@
+package restserver
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestMemoryServer(t *testing.T) {
+	mux, data, fileID, tempdir, cleanup := createTestHandler(t, &Server{
+		NoAuth:         true,
+		AppendOnly:     true,
+		Memory:         true,
+		MemoryMaxBytes: 1024,
+		PanicOnError:   true,
+	})
+	defer cleanup()
+
+	for _, req := range []*http.Request{
+		newRequest(t, "POST", "/?create=true", nil),
+		newRequest(t, "POST", "/config", strings.NewReader("config")),
+		newRequest(t, "POST", "/data/"+fileID, strings.NewReader(data)),
+		newRequest(t, "POST", "/locks/"+fileID, strings.NewReader(data)),
+	} {
+		checkRequest(t, mux.ServeHTTP, req, []wantFunc{wantCode(http.StatusOK)})
+	}
+
+	large := strings.Repeat("x", 1024)
+	req := newRequest(t, "POST", "/data/"+strings.Repeat("a", 64), strings.NewReader(large))
+	req.Header.Set("Content-Length", strconv.Itoa(len(large)))
+
+	for _, test := range []struct {
+		req  *http.Request
+		want []wantFunc
+	}{
+		{newRequest(t, "GET", "/data/"+fileID, nil), []wantFunc{wantCode(http.StatusOK), wantBody(data)}},
+		{newRequest(t, "GET", "/data/", nil), []wantFunc{wantCode(http.StatusOK), wantBody(`["` + fileID + `"]`)}},
+		// uploads are verified
+		{newRequest(t, "POST", "/index/"+fileID, strings.NewReader("other data")), []wantFunc{wantCode(http.StatusBadRequest)}},
+		// the memory limit is enforced
+		{req, []wantFunc{wantCode(http.StatusInsufficientStorage)}},
+		// append-only mode only allows deleting locks
+		{newRequest(t, "DELETE", "/data/"+fileID, nil), []wantFunc{wantCode(http.StatusForbidden)}},
+		{newRequest(t, "DELETE", "/locks/"+fileID, nil), []wantFunc{wantCode(http.StatusOK)}},
+		{newRequest(t, "GET", "/locks/"+fileID, nil), []wantFunc{wantCode(http.StatusNotFound)}},
+	} {
+		checkRequest(t, mux.ServeHTTP, test.req, test.want)
+	}
+
+	// nothing is written to the data directory
+	files, err := os.ReadDir(tempdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Errorf("data directory is not empty: %v", files)
+	}
+
+	if _, err := NewHandler(&Server{NoAuth: true, Memory: true, TrashRetention: 1}); err == nil {
+		t.Error("in-memory storage with trash did not fail")
+	}
+}
@@ -57,6 +57,77 @@ var metricBlobDeleteBytesTotal = prometheus.NewCounterVec(
 	metricLabelList,
 )
 
+var metricBlobDeleteRefusedTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "rest_server_blob_delete_refused_total",
+		Help: "Total number of blob deletions refused due to the minimum retention, a legal hold or a frozen repository",
+	},
+	metricLabelList,
+)
+
+var metricBlobReadCorruptTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "rest_server_blob_read_corrupt_total",
+		Help: "Total number of blob reads aborted because the blob is corrupt",
+	},
+	metricLabelList,
+)
+
+var metricRepoFrozenTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "rest_server_repo_frozen_total",
+		Help: "Total number of repositories frozen due to mass deletion",
+	},
+	[]string{"repo"},
+)
+
+var metricScrubBytesTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "rest_server_scrub_bytes_total",
+		Help: "Total number of bytes checked by the scrubber",
+	},
+	[]string{"repo"},
+)
+
+var metricScrubCorruptTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "rest_server_scrub_corrupt_total",
+		Help: "Total number of corrupt files found by the scrubber",
+	},
+	[]string{"repo"},
+)
+
+var metricScrubLastTimestamp = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "rest_server_scrub_last_timestamp_seconds",
+		Help: "Time of the last completed scrub of a repository",
+	},
+	[]string{"repo"},
+)
+
+var metricAuthFailuresTotal = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Name: "rest_server_auth_failures_total",
+		Help: "Total number of failed authentication attempts",
+	},
+)
+
+var metricAuthLockoutsTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "rest_server_auth_lockouts_total",
+		Help: "Total number of lockouts after too many failed authentication attempts",
+	},
+	[]string{"scope"},
+)
+
+var metricAuthLockedOut = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "rest_server_auth_locked_out",
+		Help: "Number of remote IPs or users currently locked out",
+	},
+	[]string{"scope"},
+)
+
 // makeBlobMetricFunc creates a metrics callback function that increments the
 // Prometheus metrics.
 func makeBlobMetricFunc(username string, folderPath []string) repo.BlobMetricFunc {
@@ -76,6 +147,10 @@ func makeBlobMetricFunc(username string, folderPath []string) repo.BlobMetricFun
 		case repo.BlobDelete:
 			metricBlobDeleteTotal.With(labels).Inc()
 			metricBlobDeleteBytesTotal.With(labels).Add(float64(nBytes))
+		case repo.BlobDeleteRefused:
+			metricBlobDeleteRefusedTotal.With(labels).Inc()
+		case repo.BlobReadCorrupt:
+			metricBlobReadCorruptTotal.With(labels).Inc()
 		}
 	}
 	return f
@@ -89,4 +164,13 @@ func init() {
 	prometheus.MustRegister(metricBlobReadBytesTotal)
 	prometheus.MustRegister(metricBlobDeleteTotal)
 	prometheus.MustRegister(metricBlobDeleteBytesTotal)
+	prometheus.MustRegister(metricBlobDeleteRefusedTotal)
+	prometheus.MustRegister(metricBlobReadCorruptTotal)
+	prometheus.MustRegister(metricRepoFrozenTotal)
+	prometheus.MustRegister(metricScrubBytesTotal)
+	prometheus.MustRegister(metricScrubCorruptTotal)
+	prometheus.MustRegister(metricScrubLastTimestamp)
+	prometheus.MustRegister(metricAuthFailuresTotal)
+	prometheus.MustRegister(metricAuthLockoutsTotal)
+	prometheus.MustRegister(metricAuthLockedOut)
 }
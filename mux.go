@@ -1,16 +1,22 @@
 package restserver
 
 import (
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/handlers"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/restic/rest-server/quota"
+	"github.com/restic/rest-server/repo"
 )
 
 func (s *Server) debugHandler(next http.Handler) http.Handler {
@@ -37,33 +43,192 @@ func (s *Server) logHandler(next http.Handler) http.Handler {
 	return handlers.CombinedLoggingHandler(accessLog, next)
 }
 
-func (s *Server) checkAuth(r *http.Request) (username string, ok bool) {
-	if s.NoAuth {
-		return username, true
+// identity describes an authenticated user.
+type identity struct {
+	username string
+	access   Access   // the highest access level granted to the user
+	repos    []string // if set, only repositories below these paths can be accessed
+	admin    bool     // may use the admin API
+	signed   bool     // authenticated by a signed URL
+}
+
+// allowedRepo returns true if the identity may access the repository at
+// folderPath.
+func (id identity) allowedRepo(folderPath []string) bool {
+	if len(id.repos) == 0 {
+		return true
 	}
-	if s.ProxyAuthUsername != "" {
-		username = r.Header.Get(s.ProxyAuthUsername)
-		if username == "" {
-			return "", false
+	repoPath := "/" + strings.Join(folderPath, "/")
+	for _, prefix := range id.repos {
+		prefix = "/" + strings.Trim(prefix, "/")
+		if repoPath == prefix || prefix == "/" || strings.HasPrefix(repoPath, prefix+"/") {
+			return true
 		}
-	} else {
-		var password string
-		username, password, ok = r.BasicAuth()
-		if !ok || !s.htpasswdFile.Validate(username, password) {
-			return "", false
+	}
+	return false
+}
+
+// checkAuth authenticates the request. Client certificates and tokens are
+// checked first, as they may restrict the access of a user, before the
+// credentials are passed to the Authenticator.
+func (s *Server) checkAuth(r *http.Request) (id identity, ok bool) {
+	if s.TLSClientCA != "" && r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		// the client presented a certificate signed by the client CA
+		username := s.certificateUsername(r.TLS.VerifiedChains[0][0])
+		if !ValidUsername(username) {
+			if username != "" {
+				log.Printf("Invalid username %q in client certificate", username)
+			}
+			return identity{}, false
+		}
+		return s.userIdentity(username), true
+	}
+
+	if token, ok := bearerToken(r.Header.Get("Authorization")); ok && (s.jwtVerifier != nil || s.tokens != nil) {
+		if s.jwtVerifier != nil && looksLikeJWT(token) {
+			jwtID, ok := s.jwtVerifier.Validate(token)
+			if !ok {
+				return identity{}, false
+			}
+			// the attributes of the user apply, the token may only restrict
+			// the repositories. JWTs are never granted admin access.
+			id := s.userIdentity(jwtID.username)
+			id.repos = jwtID.repos
+			id.admin = false
+			return id, true
+		}
+		if s.tokens == nil {
+			return identity{}, false
+		}
+		id, ok := s.tokens.Validate(token)
+		if !ok {
+			return identity{}, false
+		}
+		return s.tokenIdentity(id), true
+	}
+	if username, password, ok := r.BasicAuth(); ok && s.tokens != nil {
+		// tokens can also be used as password for the user they belong to
+		if id, ok := s.tokens.Validate(password); ok && id.username == username {
+			return s.tokenIdentity(id), true
+		}
+	}
+
+	auth := s.authenticator()
+	if auth == nil {
+		return identity{}, false
+	}
+	username, ok := auth.Authenticate(r)
+	if !ok {
+		return identity{}, false
+	}
+	// the username is used in paths and metric labels, noAuth returns none
+	if username != "" && !ValidUsername(username) {
+		log.Printf("Invalid username %q", username)
+		return identity{}, false
+	}
+	return s.userIdentity(username), true
+}
+
+// userIdentity returns the identity for an authenticated user, taking the
+// attributes from the htpasswd file into account.
+func (s *Server) userIdentity(username string) identity {
+	id := identity{username: username, access: AccessFull}
+	if s.htpasswdFile != nil && s.htpasswdFile.HasAttribute(username, AttributeAppendOnly) {
+		id.access = AccessAppend
+	}
+	if s.htpasswdFile != nil && s.htpasswdFile.HasAttribute(username, AttributeAdmin) {
+		id.admin = true
+	}
+	return id
+}
+
+// tokenIdentity returns the identity for a token of id.username. The scope of
+// the token cannot grant more than the user itself is allowed to do, for
+// example if the user is append-only, and tokens are never granted admin
+// access.
+func (s *Server) tokenIdentity(id identity) identity {
+	user := s.userIdentity(id.username)
+	id.access = min(id.access, user.access)
+	id.admin = false
+	return id
+}
+
+// isGroupMember returns true if username is a member of group according to
+// the group file.
+func (s *Server) isGroupMember(username, group string) bool {
+	return s.groups != nil && username != "" && s.groups.IsMember(username, group)
+}
+
+// certificateUsername returns the username for a verified client certificate
+// as selected by TLSClientUsername.
+func (s *Server) certificateUsername(cert *x509.Certificate) string {
+	switch s.TLSClientUsername {
+	case "dns":
+		if len(cert.DNSNames) > 0 {
+			return cert.DNSNames[0]
 		}
+	case "email":
+		if len(cert.EmailAddresses) > 0 {
+			return cert.EmailAddresses[0]
+		}
+	default:
+		return cert.Subject.CommonName
 	}
-	return username, true
+	return ""
+}
+
+// authenticate checks the credentials of the request using checkAuth. If the
+// authentication fails or the client is locked out after too many failed
+// attempts, an error is sent to the client.
+func (s *Server) authenticate(w http.ResponseWriter, r *http.Request) (identity, bool) {
+	if s.throttle == nil {
+		id, ok := s.checkAuth(r)
+		if !ok {
+			httpDefaultError(w, http.StatusUnauthorized)
+		}
+		return id, ok
+	}
+
+	ip := s.proxies.clientIP(r)
+	user, _, _ := r.BasicAuth()
+	if retry := s.throttle.retryAfter(ip, user, time.Now()); retry > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(retry.Seconds())+1))
+		httpDefaultError(w, http.StatusTooManyRequests)
+		return identity{}, false
+	}
+
+	id, ok := s.checkAuth(r)
+	if !ok {
+		if s.hasCredentials(r) {
+			s.throttle.fail(ip, user, time.Now())
+		}
+		httpDefaultError(w, http.StatusUnauthorized)
+		return identity{}, false
+	}
+	s.throttle.succeed(id.username)
+	return id, true
+}
+
+// hasCredentials returns true if the client presented credentials in r. Only
+// failed attempts with credentials count towards a lockout, requests without
+// them are usually sent to trigger the authentication challenge.
+func (s *Server) hasCredentials(r *http.Request) bool {
+	if r.Header.Get("Authorization") != "" {
+		return true
+	}
+	if s.ProxyAuthUsername != "" && r.Header.Get(s.ProxyAuthUsername) != "" {
+		return true
+	}
+	return r.TLS != nil && len(r.TLS.PeerCertificates) > 0
 }
 
 func (s *Server) wrapMetricsAuth(f http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		username, ok := s.checkAuth(r)
+		id, ok := s.authenticate(w, r)
 		if !ok {
-			httpDefaultError(w, http.StatusUnauthorized)
 			return
 		}
-		if s.PrivateRepos && username != "metrics" {
+		if s.PrivateRepos && id.username != "metrics" {
 			httpDefaultError(w, http.StatusUnauthorized)
 			return
 		}
@@ -71,25 +236,169 @@ func (s *Server) wrapMetricsAuth(f http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// authenticator returns the Authenticator which checks the credentials not
+// handled by checkAuth itself. It may return nil if clients can only
+// authenticate using certificates or tokens.
+func (s *Server) authenticator() Authenticator {
+	switch {
+	case s.Authenticator != nil:
+		return s.Authenticator
+	case s.NoAuth:
+		return noAuth{}
+	case s.ProxyAuthUsername != "":
+		return proxyAuth{header: s.ProxyAuthUsername, proxies: s.proxies, debug: s.Debug}
+	case s.htpasswdFile != nil:
+		return s.htpasswdFile
+	}
+	return nil
+}
+
 // NewHandler returns the master HTTP multiplexer/router.
 func NewHandler(server *Server) (http.Handler, error) {
-	if !server.NoAuth && server.ProxyAuthUsername == "" {
+	switch server.TLSClientUsername {
+	case "", "cn", "dns", "email":
+	default:
+		return nil, fmt.Errorf("invalid client certificate username %q, must be one of cn, dns or email", server.TLSClientUsername)
+	}
+
+	if !server.NoAuth && server.ProxyAuthUsername == "" && server.AuthCommand != "" && server.Authenticator == nil {
+		var err error
+		server.Authenticator, err = NewCommandAuthenticator(strings.Fields(server.AuthCommand), server.AuthCommandTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid authentication command: %v", err)
+		}
+		log.Printf("Using authentication command %s", server.AuthCommand)
+	}
+
+	if !server.NoAuth && server.ProxyAuthUsername == "" && server.Authenticator == nil {
 		var err error
 		if server.HtpasswdPath == "" {
 			server.HtpasswdPath = filepath.Join(server.Path, ".htpasswd")
 		}
 		server.htpasswdFile, err = NewHtpasswdFromFile(server.HtpasswdPath)
-		if err != nil {
+		switch {
+		case err == nil:
+			log.Printf("Loaded htpasswd file %s", server.HtpasswdPath)
+			server.htpasswdFile.UpgradeSHA = server.HtpasswdUpgradeSHA
+			server.htpasswdFile.RejectSHA = server.HtpasswdRejectSHA
+		case (server.TLSClientCA != "" || server.TokenPath != "" || server.JWKSPath != "") && errors.Is(err, os.ErrNotExist):
+			// passwords are optional if clients authenticate using certificates or tokens
+			log.Printf("No htpasswd file found, password authentication disabled")
+		default:
 			return nil, fmt.Errorf("cannot load %s (use --no-auth to disable): %v", server.HtpasswdPath, err)
 		}
-		log.Printf("Loaded htpasswd file %s", server.HtpasswdPath)
+	}
+
+	if !server.NoAuth && len(server.ProxyAuthTrusted) > 0 {
+		var err error
+		server.proxies, err = parseTrustedProxies(server.ProxyAuthTrusted)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if server.AdminAPI && server.htpasswdFile == nil {
+		return nil, errors.New("the admin API requires a htpasswd file")
+	}
+	if server.PasswordChange && server.htpasswdFile == nil {
+		return nil, errors.New("changing passwords requires a htpasswd file")
+	}
+
+	if !server.NoAuth && server.ProxyAuthUsername == "" && server.TokenPath != "" {
+		var err error
+		server.tokens, err = NewTokensFromFile(server.TokenPath)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load token file %s: %v", server.TokenPath, err)
+		}
+		log.Printf("Loaded token file %s", server.TokenPath)
+	}
+
+	if !server.NoAuth && server.ProxyAuthUsername == "" && server.JWKSPath != "" {
+		var err error
+		server.jwtVerifier, err = NewJWTVerifierFromFile(server.JWKSPath)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load JWKS file %s: %v", server.JWKSPath, err)
+		}
+		server.jwtVerifier.Issuer = server.JWTIssuer
+		server.jwtVerifier.Audience = server.JWTAudience
+		if server.JWTUsernameClaim != "" {
+			server.jwtVerifier.UsernameClaim = server.JWTUsernameClaim
+		}
+		server.jwtVerifier.ReposClaim = server.JWTReposClaim
+		log.Printf("Loaded JWKS file %s", server.JWKSPath)
+	}
+
+	if !server.NoAuth && server.GroupPath != "" {
+		var err error
+		server.groups, err = NewGroupFromFile(server.GroupPath)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load group file %s: %v", server.GroupPath, err)
+		}
+		log.Printf("Loaded group file %s", server.GroupPath)
+	}
+
+	if !server.NoAuth && server.ACLPath != "" {
+		var err error
+		server.acl, err = NewACLFromFile(server.ACLPath)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load ACL file %s: %v", server.ACLPath, err)
+		}
+		server.acl.Groups = server.groups
+		log.Printf("Loaded ACL file %s", server.ACLPath)
+	}
+
+	if server.URLSigningKeyPath != "" {
+		var err error
+		server.urlSigningKey, err = ReadURLSigningKey(server.URLSigningKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Loaded URL signing key %s", server.URLSigningKeyPath)
+	}
+
+	if !server.NoAuth && (server.MaxAuthFailuresIP > 0 || server.MaxAuthFailuresUser > 0) {
+		if server.AuthFailureWindow <= 0 || server.AuthLockout <= 0 {
+			return nil, errors.New("the authentication failure window and lockout duration must be positive")
+		}
+		server.throttle = newLoginThrottle(server.MaxAuthFailuresIP, server.MaxAuthFailuresUser,
+			server.AuthFailureWindow, server.AuthLockout)
 	}
 
 	const GiB = 1024 * 1024 * 1024
 
-	if server.MaxRepoSize > 0 {
+	if server.Memory {
+		if len(server.DataPaths) > 0 {
+			return nil, errors.New("the in-memory storage cannot be used with multiple data directories")
+		}
+		if err := checkStorageOptions(server, "the in-memory storage", true); err != nil {
+			return nil, err
+		}
+		server.storage = repo.NewMemoryStorage()
+		if server.MemoryMaxBytes > 0 {
+			server.quotaManager = quota.NewEmpty(server.MemoryMaxBytes)
+		}
+	} else if server.MemoryMaxBytes > 0 {
+		return nil, errors.New("the memory limit requires the in-memory storage")
+	}
+
+	if len(server.DataPaths) > 0 {
+		if err := checkStorageOptions(server, "multiple data directories", false); err != nil {
+			return nil, err
+		}
+		dirMode, fileMode := repo.DefaultDirMode, repo.DefaultFileMode
+		if server.GroupAccessibleRepos {
+			dirMode, fileMode = repo.GroupAccessibleDirMode, repo.GroupAccessibleFileMode
+		}
+		server.storage = &repo.JBODStorage{
+			FileStorage: repo.FileStorage{DirMode: dirMode, FileMode: fileMode},
+			Root:        server.Path,
+			DataDirs:    server.DataPaths,
+		}
+	}
+
+	if server.MaxRepoSize > 0 && !server.Memory {
 		log.Printf("Initializing quota (can take a while)...")
-		qm, err := quota.New(server.Path, server.MaxRepoSize)
+		qm, err := quota.NewPaths(append([]string{server.Path}, server.DataPaths...), server.MaxRepoSize)
 		if err != nil {
 			return nil, err
 		}
@@ -97,14 +406,53 @@ func NewHandler(server *Server) (http.Handler, error) {
 		log.Printf("Quota initialized, currently using %.2f GiB", float64(qm.SpaceUsed())/GiB)
 	}
 
+	if server.TrashRetention > 0 {
+		go server.trashPurger()
+	}
+
+	if server.MirrorPath != "" && !server.VerifyRead {
+		return nil, errors.New("the mirror path requires verifying reads")
+	}
+
+	if server.ScrubInterval > 0 {
+		go server.scrubber()
+	}
+
+	if server.DeleteGuardSnapshots > 0 || server.DeleteGuardData > 0 {
+		if server.DeleteGuardWindow <= 0 {
+			return nil, errors.New("the delete guard window must be positive")
+		}
+		server.deleteGuard = &repo.DeleteGuard{
+			Window:       server.DeleteGuardWindow,
+			MaxSnapshots: server.DeleteGuardSnapshots,
+			MaxData:      server.DeleteGuardData,
+			OnFreeze:     server.onFreeze,
+		}
+	}
+
 	mux := http.NewServeMux()
 	if server.Prometheus {
+		metrics := promhttp.Handler()
+		if throttle := server.throttle; throttle != nil {
+			// the number of lockouts is computed when the metrics are collected
+			handler := metrics
+			metrics = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				throttle.updateMetrics(time.Now())
+				handler.ServeHTTP(w, r)
+			})
+		}
 		if server.PrometheusNoAuth {
-			mux.Handle("/metrics", promhttp.Handler())
+			mux.Handle("/metrics", metrics)
 		} else {
-			mux.HandleFunc("/metrics", server.wrapMetricsAuth(promhttp.Handler().ServeHTTP))
+			mux.HandleFunc("/metrics", server.wrapMetricsAuth(metrics.ServeHTTP))
 		}
 	}
+	if server.AdminAPI {
+		mux.Handle(AdminPrefix, server.adminHandler())
+	}
+	if server.PasswordChange {
+		mux.HandleFunc(PasswordChangePath, server.changePassword)
+	}
 	mux.Handle("/", server)
 
 	var handler http.Handler = mux
@@ -116,3 +464,27 @@ func NewHandler(server *Server) (http.Handler, error) {
 	}
 	return handler, nil
 }
+
+// checkStorageOptions returns an error if features which need all files of a
+// repository in a single local directory are enabled together with storage.
+// The maximum repository size is only rejected for the in-memory storage,
+// which has its own limit.
+func checkStorageOptions(s *Server, storage string, memory bool) error {
+	for _, opt := range []struct {
+		enabled bool
+		name    string
+	}{
+		{memory && s.MaxRepoSize > 0, "the maximum repository size (use the memory limit instead)"},
+		{s.AdminAPI, "the admin API"},
+		{s.TrashRetention > 0, "the trash"},
+		{len(s.ProtectedRepos) > 0, "protected repositories"},
+		{s.DeleteGuardSnapshots > 0 || s.DeleteGuardData > 0, "the delete guard"},
+		{s.ScrubInterval > 0, "scrubbing"},
+		{s.MirrorPath != "", "the mirror path"},
+	} {
+		if opt.enabled {
+			return fmt.Errorf("%s cannot be used with %s", storage, opt.name)
+		}
+	}
+	return nil
+}
@@ -1,7 +1,15 @@
 package restserver
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -71,10 +79,128 @@ func TestCheckAuth(t *testing.T) {
 				req.SetBasicAuth(tt.basicUser, tt.basicPassword)
 			}
 
-			username, ok := tt.server.checkAuth(req)
-			if username != tt.expectedUser || ok != tt.expectedOk {
-				t.Errorf("expected (%v, %v), got (%v, %v)", tt.expectedUser, tt.expectedOk, username, ok)
+			id, ok := tt.server.checkAuth(req)
+			if id.username != tt.expectedUser || ok != tt.expectedOk {
+				t.Errorf("expected (%v, %v), got (%v, %v)", tt.expectedUser, tt.expectedOk, id.username, ok)
 			}
 		})
 	}
 }
+
+func TestCheckAuthAppendOnlyUser(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), ".htpasswd")
+	pwd := "$2y$05$z/OEmNQamd6m6LSegUErh.r/Owk9Xwmc5lxDheIuHY2Z7XiS6FtJm"
+	if err := os.WriteFile(fn, []byte("admin:"+pwd+"\nbackup:"+pwd+":append-only\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	htpass, err := NewHtpasswdFromFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &Server{htpasswdFile: htpass}
+
+	for user, want := range map[string]Access{
+		"admin":  AccessFull,
+		"backup": AccessAppend,
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.SetBasicAuth(user, "test")
+		id, ok := server.checkAuth(req)
+		if !ok {
+			t.Fatalf("%v: authentication failed", user)
+		}
+		if id.access != want {
+			t.Errorf("%v: want access %v, got %v", user, want, id.access)
+		}
+	}
+}
+
+func TestCheckAuthClientCertificate(t *testing.T) {
+	cert := &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "host1"},
+		DNSNames:       []string{"host1.example.com"},
+		EmailAddresses: []string{"backup@example.com"},
+	}
+
+	invalid := &x509.Certificate{Subject: pkix.Name{CommonName: "../host1"}}
+
+	tests := []struct {
+		server       *Server
+		certificate  *x509.Certificate
+		expectedUser string
+		expectedOk   bool
+	}{
+		{&Server{TLSClientCA: "ca.pem"}, cert, "host1", true},
+		{&Server{TLSClientCA: "ca.pem", TLSClientUsername: "cn"}, cert, "host1", true},
+		{&Server{TLSClientCA: "ca.pem", TLSClientUsername: "dns"}, cert, "host1.example.com", true},
+		{&Server{TLSClientCA: "ca.pem", TLSClientUsername: "email"}, cert, "backup@example.com", true},
+		// no certificate and no htpasswd file
+		{&Server{TLSClientCA: "ca.pem"}, nil, "", false},
+		// client certificates are only accepted if enabled
+		{&Server{ProxyAuthUsername: "X-Remote-User"}, cert, "", false},
+		// the username must be valid, as it is used in paths
+		{&Server{TLSClientCA: "ca.pem"}, invalid, "", false},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		if test.certificate != nil {
+			req.TLS = &tls.ConnectionState{
+				VerifiedChains: [][]*x509.Certificate{{test.certificate}},
+			}
+		}
+		id, ok := test.server.checkAuth(req)
+		if id.username != test.expectedUser || ok != test.expectedOk {
+			t.Errorf("expected (%v, %v), got (%v, %v)", test.expectedUser, test.expectedOk, id.username, ok)
+		}
+	}
+}
+
+func TestCheckAuthTrustedProxies(t *testing.T) {
+	proxies, err := parseTrustedProxies([]string{"192.0.2.0/24", "2001:db8::1", "unix:/run/rest-server.sock"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &Server{ProxyAuthUsername: "X-Remote-User", proxies: proxies}
+
+	tests := []struct {
+		remoteAddr string
+		localAddr  net.Addr
+		expectedOk bool
+	}{
+		{"192.0.2.10:4711", nil, true},
+		{"198.51.100.1:4711", nil, false},
+		{"[2001:db8::1]:4711", nil, true},
+		{"[2001:db8::2]:4711", nil, false},
+		{"@", &net.UnixAddr{Name: "/run/rest-server.sock", Net: "unix"}, true},
+		{"@", &net.UnixAddr{Name: "/run/other.sock", Net: "unix"}, false},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = test.remoteAddr
+		if test.localAddr != nil {
+			req = req.WithContext(context.WithValue(req.Context(), http.LocalAddrContextKey, test.localAddr))
+		}
+		req.Header.Set("X-Remote-User", "restic")
+
+		_, ok := server.checkAuth(req)
+		if ok != test.expectedOk {
+			t.Errorf("%v %v: expected %v, got %v", test.remoteAddr, test.localAddr, test.expectedOk, ok)
+		}
+	}
+
+	// invalid usernames are rejected
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "192.0.2.10:4711"
+	req.Header.Set("X-Remote-User", "alice/../bob")
+	if _, ok := server.checkAuth(req); ok {
+		t.Error("invalid username from proxy was accepted")
+	}
+
+	for _, entry := range []string{"192.0.2.0/33", "foo", ""} {
+		if _, err := parseTrustedProxies([]string{entry}); err == nil {
+			t.Errorf("expected error for %q", entry)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package restserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"unicode/utf8"
+)
+
+// PasswordChangePath is the path of the endpoint which lets users change
+// their own password when Server.PasswordChange is set. The new password is
+// sent as JSON in a POST request, authenticated with the current password:
+//
+//	{"password": "<new password>"}
+const PasswordChangePath = "/_user/password"
+
+// DefaultMinPasswordLength is the minimum length of new passwords if
+// Server.MinPasswordLength is not set.
+const DefaultMinPasswordLength = 12
+
+// checkPasswordPolicy returns an error if password may not be used.
+func (s *Server) checkPasswordPolicy(password string) error {
+	minLength := s.MinPasswordLength
+	if minLength <= 0 {
+		minLength = DefaultMinPasswordLength
+	}
+	if utf8.RuneCountInString(password) < minLength {
+		return fmt.Errorf("password must be at least %d characters long", minLength)
+	}
+	return nil
+}
+
+// changePassword handles requests to PasswordChangePath.
+func (s *Server) changePassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		httpDefaultError(w, http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, ok := s.authenticate(w, r)
+	if !ok {
+		return
+	}
+	// only users who authenticated with their password from the htpasswd
+	// file, not with a token or certificate, may change it
+	username, password, ok := r.BasicAuth()
+	if !ok || username != id.username || !s.htpasswdFile.Validate(username, password) {
+		httpDefaultError(w, http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.checkPasswordPolicy(req.Password); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := SetHtpasswdPassword(s.HtpasswdPath, username, req.Password); err != nil {
+		log.Printf("Could not change password of %s: %v", username, err)
+		httpDefaultError(w, http.StatusInternalServerError)
+		return
+	}
+	if err := s.htpasswdFile.Reload(); err != nil {
+		log.Printf("Could not reload htpasswd file: %v", err)
+	}
+	log.Printf("User %s changed their password", username)
+	w.WriteHeader(http.StatusNoContent)
+}
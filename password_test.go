@@ -0,0 +1,67 @@
+package restserver
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestChangePassword(t *testing.T) {
+	dir := t.TempDir()
+	htpasswd := filepath.Join(dir, ".htpasswd")
+	pwd := "$2y$05$z/OEmNQamd6m6LSegUErh.r/Owk9Xwmc5lxDheIuHY2Z7XiS6FtJm"
+	if err := os.WriteFile(htpasswd, []byte("restic:"+pwd+":append-only\nother:"+pwd+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	mux, _, _, _, cleanup := createTestHandler(t, &Server{
+		HtpasswdPath:      htpasswd,
+		PasswordChange:    true,
+		MinPasswordLength: 8,
+	})
+	defer cleanup()
+
+	request := func(method, user, password, body string) *http.Request {
+		req := newRequest(t, method, PasswordChangePath, strings.NewReader(body))
+		req.SetBasicAuth(user, password)
+		return req
+	}
+
+	for _, test := range []struct {
+		req  *http.Request
+		code int
+	}{
+		{request("GET", "restic", "test", ""), http.StatusMethodNotAllowed},
+		{request("POST", "restic", "wrong", `{"password": "new secret"}`), http.StatusUnauthorized},
+		{request("POST", "restic", "test", `{"password": "short"}`), http.StatusBadRequest},
+		{request("POST", "restic", "test", `invalid`), http.StatusBadRequest},
+		{request("POST", "restic", "test", `{"password": "new secret"}`), http.StatusNoContent},
+		{request("POST", "restic", "test", `{"password": "new secret"}`), http.StatusUnauthorized},
+		{request("POST", "restic", "new secret", `{"password": "newer secret"}`), http.StatusNoContent},
+		{request("POST", "other", "test", `{"password": "other secret"}`), http.StatusNoContent},
+	} {
+		checkRequest(t, mux.ServeHTTP, test.req, []wantFunc{wantCode(test.code)})
+	}
+
+	htpass, err := NewHtpasswdFromFile(htpasswd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !htpass.Validate("restic", "newer secret") || !htpass.Validate("other", "other secret") {
+		t.Error("new passwords were not saved")
+	}
+	if !htpass.HasAttribute("restic", AttributeAppendOnly) {
+		t.Error("attributes were not preserved")
+	}
+}
+
+func TestUserRepoReserved(t *testing.T) {
+	// the path of the endpoint cannot be used as repository, even if password
+	// changes are disabled
+	mux, _, _, _, cleanup := createTestHandler(t, &Server{NoAuth: true})
+	defer cleanup()
+
+	checkRequest(t, mux.ServeHTTP, newRequest(t, "POST", "/_user/?create=true", nil), []wantFunc{wantCode(http.StatusNotFound)})
+}
@@ -0,0 +1,109 @@
+package restserver
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/restic/rest-server/repo"
+)
+
+// adminProtected returns true if the repository at repoPath, as used in the
+// admin API, is listed in ProtectedRepos.
+func (s *Server) adminProtected(repoPath string) bool {
+	return s.isProtected(strings.Split(strings.Trim(repoPath, "/"), "/"))
+}
+
+func (s *Server) adminListPending(w http.ResponseWriter, r *http.Request) {
+	fsPath, ok := s.adminRepoPath(r.PathValue("path"))
+	if !ok || !isRepo(fsPath) {
+		httpDefaultError(w, http.StatusNotFound)
+		return
+	}
+	entries, err := repo.ListPending(fsPath)
+	if err != nil {
+		log.Printf("admin: cannot list pending deletions of %s: %v", fsPath, err)
+		httpDefaultError(w, http.StatusInternalServerError)
+		return
+	}
+
+	type pendingEntry struct {
+		ID string `json:"id"`
+		repo.TrashEntry
+	}
+	list := make([]pendingEntry, 0, len(entries))
+	for _, e := range entries {
+		list = append(list, pendingEntry{ID: e.ID, TrashEntry: e})
+	}
+	sendJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) adminApprovePending(w http.ResponseWriter, r *http.Request) {
+	fsPath, ok := s.adminRepoPath(r.PathValue("path"))
+	if !ok || !isRepo(fsPath) {
+		httpDefaultError(w, http.StatusNotFound)
+		return
+	}
+	var req struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// the approver is the authenticated admin, which is in the same namespace
+	// as the user who requested the deletion
+	freed, err := repo.ApprovePending(fsPath, req.ID, adminUsername(r))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		httpDefaultError(w, http.StatusNotFound)
+		return
+	case errors.Is(err, repo.ErrSameApprover):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case errors.Is(err, repo.ErrHeld):
+		http.Error(w, err.Error(), http.StatusLocked)
+		return
+	case err != nil:
+		log.Printf("admin: cannot approve deletion of %s in %s: %v", req.ID, fsPath, err)
+		httpDefaultError(w, http.StatusInternalServerError)
+		return
+	}
+	if s.quotaManager != nil {
+		s.quotaManager.DecUsage(freed)
+	}
+	log.Printf("admin: %s approved deletion of %s in %s", adminUsername(r), req.ID, fsPath)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) adminRejectPending(w http.ResponseWriter, r *http.Request) {
+	fsPath, ok := s.adminRepoPath(r.PathValue("path"))
+	if !ok || !isRepo(fsPath) {
+		httpDefaultError(w, http.StatusNotFound)
+		return
+	}
+	id := r.URL.Query().Get("id")
+
+	freed, err := repo.RejectPending(fsPath, id)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		httpDefaultError(w, http.StatusNotFound)
+		return
+	case errors.Is(err, os.ErrExist):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("admin: cannot reject deletion of %s in %s: %v", id, fsPath, err)
+		httpDefaultError(w, http.StatusInternalServerError)
+		return
+	}
+	if s.quotaManager != nil {
+		s.quotaManager.DecUsage(freed)
+	}
+	log.Printf("admin: %s rejected deletion of %s in %s", adminUsername(r), id, fsPath)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,136 @@
+package restserver
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/restic/rest-server/repo"
+)
+
+func TestPendingDeletion(t *testing.T) {
+	mux, data, fileID, tempdir, cleanup := createTestHandler(t, &Server{
+		NoAuth:         true,
+		ProtectedRepos: []string{"/"},
+		PanicOnError:   true,
+	})
+	defer cleanup()
+
+	for _, req := range []*http.Request{
+		newRequest(t, "POST", "/?create=true", nil),
+		newRequest(t, "POST", "/data/"+fileID, strings.NewReader(data)),
+		newRequest(t, "POST", "/snapshots/"+fileID, strings.NewReader(data)),
+		newRequest(t, "POST", "/keys/"+fileID, strings.NewReader(data)),
+		newRequest(t, "POST", "/locks/"+fileID, strings.NewReader(data)),
+		newRequest(t, "POST", "/config", strings.NewReader("config")),
+	} {
+		checkRequest(t, mux.ServeHTTP, req, []wantFunc{wantCode(http.StatusOK)})
+	}
+
+	// deletions succeed for the client, but the files are kept
+	checkRequest(t, mux.ServeHTTP, newRequest(t, "DELETE", "/config", nil), []wantFunc{wantCode(http.StatusOK)})
+	checkRequest(t, mux.ServeHTTP, newRequest(t, "GET", "/config", nil), []wantFunc{wantCode(http.StatusNotFound)})
+	for _, typ := range []string{"data", "snapshots", "keys", "locks"} {
+		checkRequest(t, mux.ServeHTTP, newRequest(t, "DELETE", "/"+typ+"/"+fileID, nil), []wantFunc{wantCode(http.StatusOK)})
+		checkRequest(t, mux.ServeHTTP, newRequest(t, "GET", "/"+typ+"/"+fileID, nil), []wantFunc{wantCode(http.StatusNotFound)})
+		checkRequest(t, mux.ServeHTTP, newRequest(t, "GET", "/"+typ+"/", nil), []wantFunc{wantCode(http.StatusOK), wantBody("[]")})
+	}
+	checkRequest(t, mux.ServeHTTP, newRequest(t, "GET", "/.pending/", nil), []wantFunc{wantCode(http.StatusNotFound)})
+
+	entries, err := repo.ListPending(tempdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 4 {
+		t.Fatalf("unexpected pending deletions %+v", entries)
+	}
+	ids := make(map[string]string)
+	for _, e := range entries {
+		ids[strings.Split(e.Path, "/")[0]] = e.ID
+	}
+
+	// rejecting a deletion restores the file
+	if _, err := repo.RejectPending(tempdir, ids["snapshots"]); err != nil {
+		t.Fatal(err)
+	}
+	checkRequest(t, mux.ServeHTTP, newRequest(t, "GET", "/snapshots/"+fileID, nil), []wantFunc{wantCode(http.StatusOK), wantBody(data)})
+	for _, name := range []string{"config", "keys"} {
+		if _, err := repo.RejectPending(tempdir, ids[name]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkRequest(t, mux.ServeHTTP, newRequest(t, "GET", "/config", nil), []wantFunc{wantCode(http.StatusOK), wantBody("config")})
+	checkRequest(t, mux.ServeHTTP, newRequest(t, "GET", "/keys/"+fileID, nil), []wantFunc{wantCode(http.StatusOK), wantBody(data)})
+
+	// the deletion must be approved by a different user
+	if _, err := repo.ApprovePending(tempdir, ids["data"], ""); !errors.Is(err, repo.ErrSameApprover) {
+		t.Fatalf("approval by the same user: want %v, got %v", repo.ErrSameApprover, err)
+	}
+	freed, err := repo.ApprovePending(tempdir, ids["data"], "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if freed < int64(len(data)) {
+		t.Errorf("approval freed %d bytes, want at least %d", freed, len(data))
+	}
+	files, err := os.ReadDir(filepath.Join(tempdir, repo.PendingDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Errorf("files left after approval: %v", files)
+	}
+}
+
+func TestAdminPending(t *testing.T) {
+	mux, tempdir, request := adminTestHandler(t, &Server{ProtectedRepos: []string{"/alice"}})
+
+	fileID := "8f14e45fceea167a5a36dedd4bea2543cc8c1e4d1e4d26b2b4bee9d31bd7a5f7"
+	if err := os.MkdirAll(filepath.Join(tempdir, "alice", "snapshots"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tempdir, "alice", "snapshots", fileID), []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	deleteAs := func(user string) {
+		req := newRequest(t, "DELETE", "/alice/snapshots/"+fileID, nil)
+		req.SetBasicAuth(user, "test")
+		checkRequest(t, mux.ServeHTTP, req, []wantFunc{wantCode(http.StatusOK)})
+	}
+	pendingID := func() string {
+		entries, err := repo.ListPending(filepath.Join(tempdir, "alice"))
+		if err != nil || len(entries) != 1 {
+			t.Fatalf("unexpected pending deletions %+v: %v", entries, err)
+		}
+		return entries[0].ID
+	}
+
+	// the admin cannot approve their own deletion
+	deleteAs("root")
+	id := pendingID()
+	if rr := request("POST", "/_admin/pending/alice", `{"id": "`+id+`"}`); rr.Code != http.StatusForbidden {
+		t.Fatalf("approve own deletion: want %v, got %v", http.StatusForbidden, rr.Code)
+	}
+	if rr := request("DELETE", "/_admin/pending/alice?id="+id, ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("reject: want %v, got %v: %s", http.StatusNoContent, rr.Code, rr.Body)
+	}
+
+	deleteAs("restic")
+	if rr := request("POST", "/_admin/pending/alice", `{"id": "`+pendingID()+`"}`); rr.Code != http.StatusNoContent {
+		t.Fatalf("approve: want %v, got %v: %s", http.StatusNoContent, rr.Code, rr.Body)
+	}
+	if entries, _ := repo.ListPending(filepath.Join(tempdir, "alice")); len(entries) != 0 {
+		t.Errorf("deletion still pending after approval: %+v", entries)
+	}
+
+	// protected repositories cannot be deleted or renamed
+	if rr := request("DELETE", "/_admin/repos/alice", ""); rr.Code != http.StatusForbidden {
+		t.Fatalf("delete protected repository: want %v, got %v", http.StatusForbidden, rr.Code)
+	}
+	if rr := request("PATCH", "/_admin/repos/alice", `{"path": "bob"}`); rr.Code != http.StatusForbidden {
+		t.Fatalf("rename protected repository: want %v, got %v", http.StatusForbidden, rr.Code)
+	}
+}
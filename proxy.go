@@ -0,0 +1,97 @@
+package restserver
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// trustedProxies lists the addresses from which proxy authentication headers
+// are accepted.
+type trustedProxies struct {
+	networks []*net.IPNet
+	sockets  []string // paths of unix socket listeners
+}
+
+// parseTrustedProxies parses a list of CIDR ranges, single IP addresses and
+// unix socket listeners in the form "unix:/path/to/socket".
+func parseTrustedProxies(entries []string) (*trustedProxies, error) {
+	p := &trustedProxies{}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if socket, ok := strings.CutPrefix(entry, "unix:"); ok {
+			p.sockets = append(p.sockets, socket)
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy address %q", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			p.networks = append(p.networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy network %q: %w", entry, err)
+		}
+		p.networks = append(p.networks, network)
+	}
+	return p, nil
+}
+
+// contains returns true if r was received from a trusted proxy, either from a
+// trusted IP address or on a trusted unix socket listener.
+func (p *trustedProxies) contains(r *http.Request) bool {
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok && addr.Network() == "unix" {
+		for _, socket := range p.sockets {
+			if addr.String() == socket {
+				return true
+			}
+		}
+		return false
+	}
+
+	return p.containsIP(remoteIP(r))
+}
+
+// containsIP returns true if addr is the IP address of a trusted proxy.
+func (p *trustedProxies) containsIP(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, network := range p.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the IP address of the client which sent r. For requests
+// received from a trusted proxy, the address is taken from the
+// X-Forwarded-For header, skipping the entries added by trusted proxies.
+func (p *trustedProxies) clientIP(r *http.Request) string {
+	ip := remoteIP(r)
+	if p == nil || !p.contains(r) {
+		return ip
+	}
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr := strings.TrimSpace(forwarded[i])
+		if addr == "" {
+			continue
+		}
+		ip = addr
+		if !p.containsIP(addr) {
+			break
+		}
+	}
+	return ip
+}
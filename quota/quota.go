@@ -13,8 +13,15 @@ import (
 // New creates a new quota Manager for given path.
 // It will tally the current disk usage before returning.
 func New(path string, maxSize int64) (*Manager, error) {
+	return NewPaths([]string{path}, maxSize)
+}
+
+// NewPaths creates a new quota Manager which covers the union of the given
+// paths, such as several data directories. It will tally the current disk
+// usage before returning.
+func NewPaths(paths []string, maxSize int64) (*Manager, error) {
 	m := &Manager{
-		path:        path,
+		paths:       paths,
 		maxRepoSize: maxSize,
 	}
 	if err := m.updateSize(); err != nil {
@@ -23,9 +30,15 @@ func New(path string, maxSize int64) (*Manager, error) {
 	return m, nil
 }
 
-// Manager manages the repo quota for given filesystem root path, including subrepos
+// NewEmpty creates a new quota Manager for storage which is empty, such as
+// storage in memory.
+func NewEmpty(maxSize int64) *Manager {
+	return &Manager{maxRepoSize: maxSize}
+}
+
+// Manager manages the repo quota for given filesystem root paths, including subrepos
 type Manager struct {
-	path        string
+	paths       []string
 	maxRepoSize int64
 	repoSize    int64 // must be accessed using sync/atomic
 }
@@ -50,9 +63,13 @@ func (w maxSizeWriter) Write(p []byte) (n int, err error) {
 
 func (m *Manager) updateSize() error {
 	// if we haven't yet computed the size of the repo, do so now
-	initialSize, err := tallySize(m.path)
-	if err != nil {
-		return err
+	var initialSize int64
+	for _, path := range m.paths {
+		size, err := tallySize(path)
+		if err != nil {
+			return err
+		}
+		initialSize += size
 	}
 	atomic.StoreInt64(&m.repoSize, initialSize)
 	return nil
@@ -122,3 +139,19 @@ func tallySize(path string) (int64, error) {
 	})
 	return size, err
 }
+
+// DecUsage decrements the current repo size, for example after a repository
+// was removed.
+func (m *Manager) DecUsage(by int64) {
+	atomic.AddInt64(&m.repoSize, -by)
+}
+
+// MaxRepoSize returns the configured size limit.
+func (m *Manager) MaxRepoSize() int64 {
+	return m.maxRepoSize
+}
+
+// DirSize returns the size of the contents of path as counted by the quota.
+func DirSize(path string) (int64, error) {
+	return tallySize(path)
+}
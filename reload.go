@@ -0,0 +1,71 @@
+package restserver
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// watchedFile keeps track of a configuration file on disk and reports whether
+// it has changed. The file is checked at most once per CheckInterval.
+type watchedFile struct {
+	mutex     sync.Mutex
+	path      string
+	stat      os.FileInfo
+	lastCheck time.Time
+}
+
+func newWatchedFile(path string) (*watchedFile, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	return &watchedFile{
+		path:      path,
+		stat:      stat,
+		lastCheck: time.Now(),
+	}, nil
+}
+
+// changed returns true if the modification time or size of the file differs
+// from the last time it was checked.
+func (f *watchedFile) changed() bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if time.Since(f.lastCheck) < CheckInterval {
+		return false
+	}
+	f.lastCheck = time.Now()
+
+	stat, err := os.Stat(f.path)
+	if err != nil {
+		log.Printf("Could not stat %s: %v", f.path, err)
+		return false
+	}
+	if stat.ModTime() == f.stat.ModTime() && stat.Size() == f.stat.Size() {
+		return false
+	}
+	f.stat = stat
+	return true
+}
+
+// reloadOnSIGHUP calls reload every time the process receives SIGHUP. name is
+// only used for log messages.
+func reloadOnSIGHUP(name string, reload func() error) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+
+	go func() {
+		for range c {
+			if err := reload(); err != nil {
+				log.Printf("Could not reload %s: %v", name, err)
+			} else {
+				log.Printf("Reloaded %s", name)
+			}
+		}
+	}()
+}
@@ -0,0 +1,217 @@
+package repo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/restic/rest-server/quota"
+)
+
+// FrozenFile is the name of a file within a repository which marks it as
+// frozen by a DeleteGuard. A frozen repository is append-only until the file
+// is removed using Unfreeze.
+const FrozenFile = ".frozen"
+
+// FrozenInfo is the content of a FrozenFile.
+type FrozenInfo struct {
+	Reason string    `json:"reason"`
+	User   string    `json:"user,omitempty"`
+	Frozen time.Time `json:"frozen"`
+}
+
+// ErrFrozen is returned when a repository is frozen by a DeleteGuard.
+var ErrFrozen = errors.New("repository is frozen due to mass deletion")
+
+// DeleteGuard tracks the deletions in each repository over a sliding window
+// and freezes a repository if too much of it is deleted. A single DeleteGuard
+// must be shared by all handlers.
+type DeleteGuard struct {
+	// Window is the duration over which deletions are summed up.
+	Window time.Duration
+	// MaxSnapshots is the fraction of the snapshots which may be deleted
+	// within the window, or 0 for no limit.
+	MaxSnapshots float64
+	// MaxData is the fraction of the data bytes which may be deleted within
+	// the window, or 0 for no limit.
+	MaxData float64
+	// OnFreeze is called after a repository has been frozen.
+	OnFreeze func(repoPath string, info FrozenInfo)
+
+	mutex sync.Mutex // protects repos, but not the states
+	repos map[string]*guardState
+}
+
+// guardState tracks the deletions in a single repository. Its mutex is held
+// while the size of the repository is determined, which only blocks
+// deletions in the same repository.
+type guardState struct {
+	mutex sync.Mutex
+
+	// size of the repository when the window started
+	snapshots int
+	dataBytes int64
+
+	deletes []*guardDelete
+	frozen  bool
+}
+
+type guardDelete struct {
+	time      time.Time
+	snapshots int
+	dataBytes int64
+}
+
+// state returns the state of the repository at repoPath.
+func (g *DeleteGuard) state(repoPath string) *guardState {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.repos == nil {
+		g.repos = make(map[string]*guardState)
+	}
+	st, ok := g.repos[repoPath]
+	if !ok {
+		st = &guardState{}
+		g.repos[repoPath] = st
+	}
+	return st
+}
+
+// reset determines the number of snapshots and data bytes in the repository
+// at repoPath and forgets all deletions.
+func (st *guardState) reset(repoPath string) error {
+	snapshots, err := os.ReadDir(filepath.Join(repoPath, "snapshots"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	dataBytes, err := quota.DirSize(filepath.Join(repoPath, "data"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	st.snapshots, st.dataBytes = len(snapshots), dataBytes
+	st.deletes = nil
+	st.frozen = false
+	return nil
+}
+
+// check records the deletion of the file at path of objectType in the
+// repository at repoPath. If the deletion would exceed the limits, the
+// repository is frozen and ErrFrozen is returned. Otherwise, the returned
+// function must be called if the file could not be deleted, so that the
+// deletion does not count towards the limits. It is nil if the deletion is
+// not tracked. Deleting the config of a repository always freezes it.
+func (g *DeleteGuard) check(repoPath, objectType, path, username string) (undo func(), err error) {
+	if objectType != "snapshots" && objectType != "data" && objectType != "config" {
+		return nil, nil
+	}
+	var size int64
+	if objectType == "data" || objectType == "config" {
+		stat, err := os.Stat(path)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		size = stat.Size()
+	}
+
+	st := g.state(repoPath)
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	// forget the deletions before the window and start over once the
+	// repository was unfrozen
+	now := time.Now()
+	i := 0
+	for i < len(st.deletes) && now.Sub(st.deletes[i].time) > g.Window {
+		i++
+	}
+	st.deletes = st.deletes[i:]
+	if len(st.deletes) == 0 || (st.frozen && !IsFrozen(repoPath)) {
+		if err := st.reset(repoPath); err != nil {
+			return nil, err
+		}
+	}
+
+	d := &guardDelete{time: now}
+	switch objectType {
+	case "snapshots":
+		d.snapshots = 1
+	case "data":
+		d.dataBytes = size
+	}
+	var snapshots int
+	var dataBytes int64
+	for _, prev := range st.deletes {
+		snapshots += prev.snapshots
+		dataBytes += prev.dataBytes
+	}
+	snapshots += d.snapshots
+	dataBytes += d.dataBytes
+
+	var reason string
+	switch {
+	case objectType == "config":
+		// the repository cannot be used without its config
+		reason = "config deleted"
+	case g.MaxSnapshots > 0 && d.snapshots > 0 && float64(snapshots) > g.MaxSnapshots*float64(st.snapshots):
+		reason = fmt.Sprintf("%d of %d snapshots deleted within %v", snapshots, st.snapshots, g.Window)
+	case g.MaxData > 0 && d.dataBytes > 0 && float64(dataBytes) > g.MaxData*float64(st.dataBytes):
+		reason = fmt.Sprintf("%d of %d data bytes deleted within %v", dataBytes, st.dataBytes, g.Window)
+	}
+	if reason == "" {
+		// the deletion is recorded right away, so that concurrent deletions
+		// cannot exceed the limits
+		st.deletes = append(st.deletes, d)
+		return func() { st.forget(d) }, nil
+	}
+
+	info := FrozenInfo{Reason: reason, User: username, Frozen: now.UTC()}
+	if err := freeze(repoPath, info); err != nil {
+		return nil, err
+	}
+	st.frozen = true
+	if g.OnFreeze != nil {
+		g.OnFreeze(repoPath, info)
+	}
+	return nil, ErrFrozen
+}
+
+// forget removes the deletion d, for example because the file could not be
+// deleted.
+func (st *guardState) forget(d *guardDelete) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	for i, prev := range st.deletes {
+		if prev == d {
+			st.deletes = append(st.deletes[:i], st.deletes[i+1:]...)
+			return
+		}
+	}
+}
+
+func freeze(repoPath string, info FrozenInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(repoPath, FrozenFile), data, DefaultFileMode)
+}
+
+// IsFrozen returns true if the repository at repoPath is frozen.
+func IsFrozen(repoPath string) bool {
+	_, err := os.Lstat(filepath.Join(repoPath, FrozenFile))
+	return err == nil
+}
+
+// Unfreeze allows deletions in the frozen repository at repoPath again.
+func Unfreeze(repoPath string) error {
+	return os.Remove(filepath.Join(repoPath, FrozenFile))
+}
@@ -0,0 +1,170 @@
+package repo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// HoldDir is the directory within a repository which holds the legal holds
+// placed on objects. A hold on an object is stored as .holds/<type>/<id>.
+const HoldDir = ".holds"
+
+// ErrHeld is returned when an object cannot be deleted because of a legal
+// hold.
+var ErrHeld = errors.New("object is under legal hold")
+
+// Hold is a legal hold on an object, which prevents it from being deleted
+// until the hold is released.
+type Hold struct {
+	Type    string    `json:"type"`
+	ID      string    `json:"id"`
+	Reason  string    `json:"reason,omitempty"`
+	User    string    `json:"user,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+// validHold returns true if a hold can be placed on the object.
+func validHold(objectType, objectID string) bool {
+	return objectType != "locks" && objectID != "" && BlobPathRE.MatchString("/"+objectType+"/"+objectID)
+}
+
+func holdPath(repoPath, objectType, objectID string) string {
+	return filepath.Join(repoPath, HoldDir, objectType, objectID)
+}
+
+// isHeld returns true if there is a hold on the object.
+func isHeld(repoPath, objectType, objectID string) (bool, error) {
+	if !validHold(objectType, objectID) {
+		return false, nil
+	}
+	_, err := os.Lstat(holdPath(repoPath, objectType, objectID))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// objectExists returns true if the object is stored in the repository, in its
+// trash or awaiting approval for deletion. The object is looked up using
+// storage.
+func objectExists(storage Storage, repoPath, objectType, objectID string) (bool, error) {
+	rel := objectType + "/" + objectID
+	if isHashed(objectType) {
+		rel = objectType + "/" + objectID[:2] + "/" + objectID
+	}
+	if _, err := storage.Stat(filepath.Join(repoPath, filepath.FromSlash(rel))); err == nil {
+		return true, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return false, err
+	}
+
+	for _, dir := range []string{TrashDir, PendingDir} {
+		entries, err := listAside(repoPath, dir)
+		if err != nil {
+			return false, err
+		}
+		for _, e := range entries {
+			if e.Path == rel {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// PlaceHold places a hold on an object in the repository at repoPath. The
+// object must exist in storage, see objectExists. If storage is nil, the
+// object is looked up in the local filesystem. It returns the number of bytes
+// used by the hold.
+func PlaceHold(storage Storage, repoPath string, hold Hold) (int64, error) {
+	if !validHold(hold.Type, hold.ID) {
+		return 0, fmt.Errorf("invalid object %s/%s: %w", hold.Type, hold.ID, os.ErrInvalid)
+	}
+	if storage == nil {
+		storage = &FileStorage{DirMode: DefaultDirMode, FileMode: DefaultFileMode}
+	}
+	exists, err := objectExists(storage, repoPath, hold.Type, hold.ID)
+	if err != nil {
+		return 0, err
+	}
+	if !exists {
+		return 0, fmt.Errorf("%s/%s: %w", hold.Type, hold.ID, os.ErrNotExist)
+	}
+
+	fn := holdPath(repoPath, hold.Type, hold.ID)
+	if err := os.MkdirAll(filepath.Dir(fn), DefaultDirMode); err != nil {
+		return 0, err
+	}
+	data, err := json.Marshal(hold)
+	if err != nil {
+		return 0, err
+	}
+	f, err := os.OpenFile(fn, os.O_WRONLY|os.O_CREATE|os.O_EXCL, DefaultFileMode)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		_ = os.Remove(fn)
+		return 0, err
+	}
+	return int64(len(data)), f.Close()
+}
+
+// ListHolds returns the holds placed on objects in the repository at
+// repoPath.
+func ListHolds(repoPath string) ([]Hold, error) {
+	var holds []Hold
+	for _, objectType := range ObjectTypes {
+		dir := filepath.Join(repoPath, HoldDir, objectType)
+		files, err := os.ReadDir(dir)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			if !validHold(objectType, f.Name()) {
+				continue
+			}
+			data, err := os.ReadFile(filepath.Join(dir, f.Name()))
+			if err != nil {
+				return nil, err
+			}
+			var h Hold
+			if err := json.Unmarshal(data, &h); err != nil {
+				return nil, fmt.Errorf("invalid hold %s/%s: %w", objectType, f.Name(), err)
+			}
+			h.Type, h.ID = objectType, f.Name()
+			holds = append(holds, h)
+		}
+	}
+	return holds, nil
+}
+
+// ReleaseHold removes the hold on an object in the repository at repoPath. It
+// returns the number of bytes freed.
+func ReleaseHold(repoPath, objectType, objectID string) (int64, error) {
+	if !validHold(objectType, objectID) {
+		return 0, os.ErrNotExist
+	}
+	fn := holdPath(repoPath, objectType, objectID)
+	stat, err := os.Lstat(fn)
+	if err != nil {
+		return 0, err
+	}
+	return stat.Size(), os.Remove(fn)
+}
+
+// trashEntryHeld returns true if there is a hold on the object which was moved
+// to the trash as e.
+func trashEntryHeld(repoPath string, e TrashEntry) (bool, error) {
+	objectType, _, _ := strings.Cut(e.Path, "/")
+	return isHeld(repoPath, objectType, filepath.Base(filepath.FromSlash(e.Path)))
+}
@@ -0,0 +1,148 @@
+package repo
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// JBODStorage spreads the data files of repositories across several
+// directories, for example on independent disks. The repositories and all
+// other files are stored below Root. The data files are stored in the same
+// layout below Root or one of DataDirs, which is selected based on their
+// intermediate directory. Lookups consult all directories, so that the
+// directories can be changed later on.
+type JBODStorage struct {
+	FileStorage
+	Root     string
+	DataDirs []string
+}
+
+// dataPaths returns the possible locations of path, starting with the one
+// where a new file is stored. Only data files, stored as
+// <repo>/data/<xx>/<id> where xx are the first two characters of the id, can
+// be stored outside of Root. Other files of a repository whose path ends in
+// data/<xx>, such as its config, always stay below Root.
+func (s *JBODStorage) dataPaths(path string) []string {
+	rel, err := filepath.Rel(s.Root, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return []string{path}
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	if len(parts) < 3 || parts[len(parts)-3] != "data" {
+		return []string{path}
+	}
+	dir, id := parts[len(parts)-2], parts[len(parts)-1]
+	if id == "" || !BlobPathRE.MatchString("/data/"+id) || !strings.HasPrefix(id, dir) {
+		return []string{path}
+	}
+	shard, err := strconv.ParseUint(dir, 16, 8)
+	if err != nil {
+		return []string{path}
+	}
+
+	dirs := append([]string{s.Root}, s.DataDirs...)
+	first := int(shard) % len(dirs)
+	paths := make([]string, 0, len(dirs))
+	for i := range dirs {
+		paths = append(paths, filepath.Join(dirs[(first+i)%len(dirs)], rel))
+	}
+	return paths
+}
+
+// Stat returns information about the file at path.
+func (s *JBODStorage) Stat(path string) (os.FileInfo, error) {
+	var err error
+	for _, p := range s.dataPaths(path) {
+		var fi os.FileInfo
+		fi, err = s.FileStorage.Stat(p)
+		if !errors.Is(err, os.ErrNotExist) {
+			return fi, err
+		}
+	}
+	return nil, err
+}
+
+// Open opens the file at path for reading.
+func (s *JBODStorage) Open(path string) (File, error) {
+	var err error
+	for _, p := range s.dataPaths(path) {
+		var f File
+		f, err = s.FileStorage.Open(p)
+		if !errors.Is(err, os.ErrNotExist) {
+			return f, err
+		}
+	}
+	return nil, err
+}
+
+// Create returns a file which is stored at path once it is committed. Data
+// files are stored in the directory selected for their intermediate
+// directory.
+func (s *JBODStorage) Create(path string) (TempFile, error) {
+	return s.FileStorage.Create(s.dataPaths(path)[0])
+}
+
+// CreateExclusive is like Create, but committing the file fails if it already
+// exists in the directory selected for it.
+func (s *JBODStorage) CreateExclusive(path string) (TempFile, error) {
+	return s.FileStorage.CreateExclusive(s.dataPaths(path)[0])
+}
+
+// List returns the files of objectType in the repository at repoPath. For
+// data files, the files in all directories are listed, sorted by name like the
+// files of a single directory.
+func (s *JBODStorage) List(repoPath string, objectType string) ([]Blob, error) {
+	blobs, err := s.FileStorage.List(repoPath, objectType)
+	if err != nil || objectType != "data" {
+		return blobs, err
+	}
+	rel, err := filepath.Rel(s.Root, repoPath)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(blobs))
+	for _, b := range blobs {
+		seen[b.Name] = true
+	}
+	for _, dir := range s.DataDirs {
+		more, err := s.FileStorage.List(filepath.Join(dir, rel), objectType)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range more {
+			if !seen[b.Name] {
+				seen[b.Name] = true
+				blobs = append(blobs, b)
+			}
+		}
+	}
+	sort.Slice(blobs, func(i, j int) bool { return blobs[i].Name < blobs[j].Name })
+	return blobs, nil
+}
+
+// Remove removes the file at path from all directories.
+func (s *JBODStorage) Remove(path string) error {
+	removed := false
+	for _, p := range s.dataPaths(path) {
+		err := s.FileStorage.Remove(p)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		removed = true
+	}
+	if !removed {
+		return &os.PathError{Op: "remove", Path: path, Err: os.ErrNotExist}
+	}
+	return nil
+}
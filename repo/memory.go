@@ -0,0 +1,175 @@
+package repo
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStorage keeps files in memory. All data is lost when the process
+// exits.
+type MemoryStorage struct {
+	mutex sync.RWMutex
+	files map[string]*memFile
+	dirs  map[string]bool
+}
+
+// NewMemoryStorage returns an empty MemoryStorage.
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		files: make(map[string]*memFile),
+		dirs:  make(map[string]bool),
+	}
+}
+
+type memFile struct {
+	name    string
+	data    []byte
+	modTime time.Time
+}
+
+func (f *memFile) Name() string       { return f.name }
+func (f *memFile) Size() int64        { return int64(len(f.data)) }
+func (f *memFile) Mode() fs.FileMode  { return DefaultFileMode }
+func (f *memFile) ModTime() time.Time { return f.modTime }
+func (f *memFile) IsDir() bool        { return false }
+func (f *memFile) Sys() interface{}   { return nil }
+
+// Stat returns information about the file at path.
+func (s *MemoryStorage) Stat(path string) (os.FileInfo, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	f, ok := s.files[filepath.Clean(path)]
+	if !ok {
+		return nil, &os.PathError{Op: "stat", Path: path, Err: os.ErrNotExist}
+	}
+	return f, nil
+}
+
+// Open opens the file at path for reading.
+func (s *MemoryStorage) Open(path string) (File, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	f, ok := s.files[filepath.Clean(path)]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrNotExist}
+	}
+	// files are never modified after they were committed
+	return &memReader{Reader: bytes.NewReader(f.data), file: f}, nil
+}
+
+type memReader struct {
+	*bytes.Reader
+	file *memFile
+}
+
+func (r *memReader) Close() error               { return nil }
+func (r *memReader) Stat() (os.FileInfo, error) { return r.file, nil }
+
+// Create returns a file which is stored at path once it is committed.
+func (s *MemoryStorage) Create(path string) (TempFile, error) {
+	return &memTemp{storage: s, path: filepath.Clean(path)}, nil
+}
+
+// CreateExclusive returns a file which is stored at path once it is committed,
+// unless a file at path already exists.
+func (s *MemoryStorage) CreateExclusive(path string) (TempFile, error) {
+	return &memTemp{storage: s, path: filepath.Clean(path), exclusive: true}, nil
+}
+
+type memTemp struct {
+	bytes.Buffer
+	storage   *MemoryStorage
+	path      string
+	exclusive bool
+}
+
+func (t *memTemp) Commit() (bool, error) {
+	s := t.storage
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.files[t.path]; ok && t.exclusive {
+		t.Reset()
+		return false, &os.PathError{Op: "create", Path: t.path, Err: os.ErrExist}
+	}
+	s.mkdirAll(filepath.Dir(t.path))
+	s.files[t.path] = &memFile{
+		name:    filepath.Base(t.path),
+		data:    bytes.Clone(t.Bytes()),
+		modTime: time.Now(),
+	}
+	t.Reset()
+	return false, nil
+}
+
+func (t *memTemp) Abort() error {
+	t.Reset()
+	return nil
+}
+
+// List returns the files of objectType in the repository at repoPath.
+func (s *MemoryStorage) List(repoPath string, objectType string) ([]Blob, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	dir := filepath.Join(repoPath, objectType)
+	if !s.dirs[dir] {
+		return nil, &os.PathError{Op: "open", Path: dir, Err: os.ErrNotExist}
+	}
+	// files of hashed types are stored in an intermediate directory
+	depth := 1
+	if isHashed(objectType) {
+		depth = 2
+	}
+
+	blobs := []Blob{}
+	prefix := dir + string(filepath.Separator)
+	for path, f := range s.files {
+		rel, ok := strings.CutPrefix(path, prefix)
+		if !ok || strings.Count(rel, string(filepath.Separator)) != depth-1 {
+			continue
+		}
+		blobs = append(blobs, Blob{Name: f.name, Size: f.Size()})
+	}
+	return blobs, nil
+}
+
+// Remove removes the file at path.
+func (s *MemoryStorage) Remove(path string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	path = filepath.Clean(path)
+	if _, ok := s.files[path]; !ok {
+		return &os.PathError{Op: "remove", Path: path, Err: os.ErrNotExist}
+	}
+	delete(s.files, path)
+	return nil
+}
+
+// MkdirAll creates the directory at path and its parents.
+func (s *MemoryStorage) MkdirAll(path string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.mkdirAll(filepath.Clean(path))
+	return nil
+}
+
+func (s *MemoryStorage) mkdirAll(dir string) {
+	for !s.dirs[dir] {
+		s.dirs[dir] = true
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return
+		}
+		dir = parent
+	}
+}
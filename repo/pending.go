@@ -0,0 +1,64 @@
+package repo
+
+import (
+	"errors"
+	"os"
+)
+
+// PendingDir is the directory within a repository which holds files whose
+// deletion awaits approval if Options.Protected is set.
+const PendingDir = ".pending"
+
+// ErrSameApprover is returned if a deletion is approved by the user who
+// requested it.
+var ErrSameApprover = errors.New("deletion must be approved by a different user")
+
+// needsApproval returns true if deleting objects of objectType must be
+// approved in a protected repository. Deleting the config always requires
+// approval.
+func needsApproval(objectType string) bool {
+	return objectType == "data" || objectType == "index" || objectType == "keys" || objectType == "snapshots"
+}
+
+// ListPending returns the files awaiting approval for deletion in the
+// repository at repoPath.
+func ListPending(repoPath string) ([]TrashEntry, error) {
+	return listAside(repoPath, PendingDir)
+}
+
+// ApprovePending permanently removes the file with id awaiting approval for
+// deletion in the repository at repoPath. The approver must be different from
+// the user who requested the deletion. The number of bytes freed is returned.
+func ApprovePending(repoPath string, id string, approver string) (int64, error) {
+	if !validTrashID(id) {
+		return 0, os.ErrNotExist
+	}
+	entries, err := ListPending(repoPath)
+	if err != nil {
+		return 0, err
+	}
+	for _, e := range entries {
+		if e.ID != id {
+			continue
+		}
+		if approver == "" || approver == e.User {
+			return 0, ErrSameApprover
+		}
+		held, err := trashEntryHeld(repoPath, e)
+		if err != nil {
+			return 0, err
+		}
+		if held {
+			return 0, ErrHeld
+		}
+		return removeAside(repoPath, PendingDir, id)
+	}
+	return 0, os.ErrNotExist
+}
+
+// RejectPending moves the file with id awaiting approval for deletion back to
+// its original location in the repository at repoPath. It returns the number
+// of bytes freed by removing the metadata.
+func RejectPending(repoPath string, id string) (int64, error) {
+	return restoreAside(repoPath, PendingDir, id)
+}
@@ -27,6 +27,7 @@ import (
 // Options are options for the Handler accepted by New
 type Options struct {
 	AppendOnly     bool // if set, delete actions are not allowed
+	ReadOnly       bool // if set, only lock files may be written or deleted
 	Debug          bool
 	NoVerifyUpload bool
 
@@ -38,9 +39,33 @@ type Options struct {
 	QuotaManager   *quota.Manager
 	FsyncWarning   *sync.Once
 
+	// Storage holds the files of the repository. If it is nil, the files are
+	// stored in the local filesystem.
+	Storage Storage
+
 	// If set makes files group accessible
 	GroupAccessible bool
 
+	// If set, deleted files except locks are moved to the trash
+	Trash bool
+	// Verify the hash of files while they are read completely and abort the
+	// response if they are corrupt
+	VerifyRead bool
+	// Path of a copy of the repository which is used to repair corrupt files
+	// found by VerifyRead
+	MirrorPath string
+	// If set, repositories in which too much is deleted are frozen
+	DeleteGuard *DeleteGuard
+	// Deleting the config and data, index, keys and snapshot files only moves
+	// them to PendingDir until the deletion is approved
+	Protected bool
+	// Name of the authenticated user, recorded for files moved to the trash
+	// or awaiting approval for deletion
+	Username string
+	// Files except locks which are younger than this cannot be deleted. It
+	// can be overridden per repository using a RetentionFile.
+	MinRetention time.Duration
+
 	// Defaults dir and file mode
 	dirMode  os.FileMode
 	fileMode os.FileMode
@@ -78,9 +103,20 @@ func New(path string, opt Options) (*Handler, error) {
 		opt.fileMode = GroupAccessibleFileMode
 	}
 
+	// frozen repositories are append-only until they are unfrozen
+	if IsFrozen(path) {
+		opt.AppendOnly = true
+	}
+
+	storage := opt.Storage
+	if storage == nil {
+		storage = &FileStorage{DirMode: opt.dirMode, FileMode: opt.fileMode}
+	}
+
 	h := Handler{
-		path: path,
-		opt:  opt,
+		path:    path,
+		opt:     opt,
+		storage: storage,
 	}
 	return &h, nil
 }
@@ -88,8 +124,9 @@ func New(path string, opt Options) (*Handler, error) {
 // Handler handles all REST API requests for a single Restic backup repo
 // Spec: https://restic.readthedocs.io/en/latest/100_references.html#rest-backend
 type Handler struct {
-	path string // filesystem path of repo
-	opt  Options
+	path    string // filesystem path of repo
+	opt     Options
+	storage Storage
 }
 
 // httpDefaultError write a HTTP error with the default description
@@ -118,6 +155,12 @@ var ObjectTypes = []string{"data", "index", "keys", "locks", "snapshots"}
 // through a request
 var FileTypes = []string{"config"}
 
+// ReservedNames are names of files and directories within a repository which
+// are used internally by the server, and the first path elements of the admin
+// API and the password change endpoint. They cannot be accessed as
+// repositories.
+var ReservedNames = []string{TrashDir, RetentionFile, HoldDir, PendingDir, FrozenFile, QuarantineDir, "_admin", "_user"}
+
 func isHashed(objectType string) bool {
 	return objectType == "data"
 }
@@ -127,9 +170,11 @@ type BlobOperation byte
 
 // Define all valid operations.
 const (
-	BlobRead   = 'R' // A blob has been read
-	BlobWrite  = 'W' // A blob has been written
-	BlobDelete = 'D' // A blob has been deleted
+	BlobRead          = 'R' // A blob has been read
+	BlobWrite         = 'W' // A blob has been written
+	BlobDelete        = 'D' // A blob has been deleted
+	BlobDeleteRefused = 'd' // Deleting a blob has been refused by the minimum retention, a legal hold or the delete guard
+	BlobReadCorrupt   = 'C' // A blob read has been aborted because the blob is corrupt
 )
 
 // BlobMetricFunc is the callback signature for blob metrics. Such a callback
@@ -272,7 +317,7 @@ func (h *Handler) checkConfig(w http.ResponseWriter, _ *http.Request) {
 	}
 	cfg := h.getSubPath("config")
 
-	st, err := os.Stat(cfg)
+	st, err := h.storage.Stat(cfg)
 	if err != nil {
 		h.fileAccessError(w, err)
 		return
@@ -288,11 +333,17 @@ func (h *Handler) getConfig(w http.ResponseWriter, _ *http.Request) {
 	}
 	cfg := h.getSubPath("config")
 
-	bytes, err := os.ReadFile(cfg)
+	f, err := h.storage.Open(cfg)
 	if err != nil {
 		h.fileAccessError(w, err)
 		return
 	}
+	bytes, err := io.ReadAll(f)
+	_ = f.Close()
+	if err != nil {
+		h.internalServerError(w, err)
+		return
+	}
 
 	_, _ = w.Write(bytes)
 }
@@ -302,25 +353,45 @@ func (h *Handler) saveConfig(w http.ResponseWriter, r *http.Request) {
 	if h.opt.Debug {
 		log.Println("saveConfig()")
 	}
+
+	if h.opt.ReadOnly {
+		httpDefaultError(w, http.StatusForbidden)
+		return
+	}
+
 	cfg := h.getSubPath("config")
 
-	f, err := os.OpenFile(cfg, os.O_CREATE|os.O_WRONLY|os.O_EXCL, h.opt.fileMode)
-	if err != nil && os.IsExist(err) {
+	if _, err := h.storage.Stat(cfg); err == nil {
 		if h.opt.Debug {
-			log.Print(err)
+			log.Printf("%s already exists", cfg)
 		}
 		httpDefaultError(w, http.StatusForbidden)
 		return
 	}
 
-	_, err = io.Copy(f, r.Body)
+	// the config may have been created by a concurrent request in the
+	// meantime, which must not be overwritten
+	f, err := h.storage.CreateExclusive(cfg)
 	if err != nil {
 		h.internalServerError(w, err)
 		return
 	}
 
-	err = f.Close()
+	_, err = io.Copy(f, r.Body)
 	if err != nil {
+		_ = f.Abort()
+		h.internalServerError(w, err)
+		return
+	}
+
+	if _, err := f.Commit(); err != nil {
+		if errors.Is(err, os.ErrExist) {
+			if h.opt.Debug {
+				log.Printf("%s already exists", cfg)
+			}
+			httpDefaultError(w, http.StatusForbidden)
+			return
+		}
 		h.internalServerError(w, err)
 		return
 	}
@@ -334,14 +405,66 @@ func (h *Handler) deleteConfig(w http.ResponseWriter, _ *http.Request) {
 		log.Println("deleteConfig()")
 	}
 
-	if h.opt.AppendOnly {
+	if h.opt.AppendOnly || h.opt.ReadOnly {
+		httpDefaultError(w, http.StatusForbidden)
+		return
+	}
+
+	// restic never deletes the config of a repository, and the repository
+	// cannot be used without it, so it is protected regardless of its age
+	retention, err := h.minRetention()
+	if err != nil {
+		h.internalServerError(w, err)
+		return
+	}
+	if retention > 0 {
+		if h.opt.Debug {
+			log.Printf("refusing to delete config with a minimum retention of %v", retention)
+		}
+		h.sendMetric("config", BlobDeleteRefused, 0)
 		httpDefaultError(w, http.StatusForbidden)
 		return
 	}
 
 	cfg := h.getSubPath("config")
 
-	if err := os.Remove(cfg); err != nil {
+	if h.opt.DeleteGuard != nil {
+		// the deletion of an existing config is never allowed, so there is
+		// nothing to undo
+		_, err := h.opt.DeleteGuard.check(h.path, "config", cfg, h.opt.Username)
+		if errors.Is(err, ErrFrozen) {
+			h.sendMetric("config", BlobDeleteRefused, 0)
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			h.internalServerError(w, err)
+			return
+		}
+	}
+
+	if h.opt.Protected {
+		// the config is hidden until the deletion is approved or rejected
+		metaSize, err := h.moveAside(PendingDir, "config")
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			h.fileAccessError(w, err)
+			return
+		}
+		h.incrementRepoSpaceUsage(metaSize)
+		return
+	}
+
+	if h.opt.Trash {
+		metaSize, err := h.moveToTrash("config")
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			h.fileAccessError(w, err)
+			return
+		}
+		h.incrementRepoSpaceUsage(metaSize)
+		return
+	}
+
+	if err := h.storage.Remove(cfg); err != nil {
 		// ignore not exist errors to make deleting idempotent, which is
 		// necessary to properly handle request retries
 		if !errors.Is(err, os.ErrNotExist) {
@@ -382,34 +505,16 @@ func (h *Handler) listBlobsV1(w http.ResponseWriter, r *http.Request) {
 			"cannot determine object type: %s", r.URL.Path))
 		return
 	}
-	path := h.getSubPath(objectType)
 
-	items, err := os.ReadDir(path)
+	blobs, err := h.storage.List(h.path, objectType)
 	if err != nil {
 		h.fileAccessError(w, err)
 		return
 	}
 
 	names := []string{}
-	for _, i := range items {
-		if isHashed(objectType) {
-			if !i.IsDir() {
-				// ignore files in intermediate directories
-				continue
-			}
-			subpath := filepath.Join(path, i.Name())
-			var subitems []os.DirEntry
-			subitems, err = os.ReadDir(subpath)
-			if err != nil {
-				h.fileAccessError(w, err)
-				return
-			}
-			for _, f := range subitems {
-				names = append(names, f.Name())
-			}
-		} else {
-			names = append(names, i.Name())
-		}
+	for _, b := range blobs {
+		names = append(names, b.Name)
 	}
 
 	data, err := json.Marshal(names)
@@ -441,46 +546,13 @@ func (h *Handler) listBlobsV2(w http.ResponseWriter, r *http.Request) {
 			"cannot determine object type: %s", r.URL.Path))
 		return
 	}
-	path := h.getSubPath(objectType)
 
-	items, err := os.ReadDir(path)
+	blobs, err := h.storage.List(h.path, objectType)
 	if err != nil {
 		h.fileAccessError(w, err)
 		return
 	}
 
-	blobs := []Blob{}
-	for _, i := range items {
-		if isHashed(objectType) {
-			if !i.IsDir() {
-				// ignore files in intermediate directories
-				continue
-			}
-			subpath := filepath.Join(path, i.Name())
-			var subitems []os.DirEntry
-			subitems, err = os.ReadDir(subpath)
-			if err != nil {
-				h.fileAccessError(w, err)
-				return
-			}
-			for _, f := range subitems {
-				fi, err := f.Info()
-				if err != nil {
-					h.fileAccessError(w, err)
-					return
-				}
-				blobs = append(blobs, Blob{Name: f.Name(), Size: fi.Size()})
-			}
-		} else {
-			fi, err := i.Info()
-			if err != nil {
-				h.fileAccessError(w, err)
-				return
-			}
-			blobs = append(blobs, Blob{Name: i.Name(), Size: fi.Size()})
-		}
-	}
-
 	data, err := json.Marshal(blobs)
 	if err != nil {
 		h.internalServerError(w, err)
@@ -505,7 +577,7 @@ func (h *Handler) checkBlob(w http.ResponseWriter, r *http.Request) {
 	}
 	path := h.getObjectPath(objectType, objectID)
 
-	st, err := os.Stat(path)
+	st, err := h.storage.Stat(path)
 	if err != nil {
 		h.fileAccessError(w, err)
 		return
@@ -528,14 +600,40 @@ func (h *Handler) getBlob(w http.ResponseWriter, r *http.Request) {
 	}
 	path := h.getObjectPath(objectType, objectID)
 
-	file, err := os.Open(path)
+	file, err := h.storage.Open(path)
 	if err != nil {
 		h.fileAccessError(w, err)
 		return
 	}
 
 	wc := datacounter.NewResponseWriterCounter(w)
-	http.ServeContent(wc, r, "", time.Unix(0, 0), file)
+	if !h.opt.VerifyRead {
+		http.ServeContent(wc, r, "", time.Unix(0, 0), file)
+	} else {
+		stat, err := file.Stat()
+		if err != nil {
+			_ = file.Close()
+			h.internalServerError(w, err)
+			return
+		}
+		// avoid sniffing the content type, which reads the start of the file
+		wc.Header().Set("Content-Type", "application/octet-stream")
+		vr := newVerifyingReader(file, objectID, stat.Size())
+		http.ServeContent(wc, r, "", time.Unix(0, 0), vr)
+
+		if vr.corrupt {
+			_ = file.Close()
+			log.Printf("ERROR: %s is corrupt, aborted the response", path)
+			h.sendMetric(objectType, BlobReadCorrupt, 0)
+			if h.opt.MirrorPath != "" {
+				if err := h.repairFromMirror(objectType, objectID, path); err != nil {
+					log.Printf("ERROR: cannot repair %s from the mirror: %v", path, err)
+				}
+			}
+			// make sure the client notices the failed transfer
+			panic(http.ErrAbortHandler)
+		}
+	}
 
 	if err = file.Close(); err != nil {
 		h.internalServerError(w, err)
@@ -557,9 +655,14 @@ func (h *Handler) saveBlob(w http.ResponseWriter, r *http.Request) {
 			"cannot determine object type or id: %s", r.URL.Path))
 		return
 	}
+	if h.opt.ReadOnly && objectType != "locks" {
+		httpDefaultError(w, http.StatusForbidden)
+		return
+	}
+
 	path := h.getObjectPath(objectType, objectID)
 
-	_, err := os.Stat(path)
+	_, err := h.storage.Stat(path)
 	if err == nil {
 		httpDefaultError(w, http.StatusForbidden)
 		return
@@ -569,18 +672,7 @@ func (h *Handler) saveBlob(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tmpFn := filepath.Join(filepath.Dir(path), objectID+".rest-server-temp")
-	tf, err := tempFile(tmpFn, h.opt.fileMode)
-	if os.IsNotExist(err) {
-		// the error is caused by a missing directory, create it and retry
-		mkdirErr := os.MkdirAll(filepath.Dir(path), h.opt.dirMode)
-		if mkdirErr != nil {
-			log.Print(mkdirErr)
-		} else {
-			// try again
-			tf, err = tempFile(tmpFn, h.opt.fileMode)
-		}
-	}
+	tf, err := h.storage.Create(path)
 	if err != nil {
 		h.internalServerError(w, err)
 		return
@@ -589,6 +681,7 @@ func (h *Handler) saveBlob(w http.ResponseWriter, r *http.Request) {
 	// ensure this blob does not put us over the quota size limit (if there is one)
 	outFile, errCode, err := h.wrapFileWriter(r, tf)
 	if err != nil {
+		_ = tf.Abort()
 		if h.opt.Debug {
 			log.Println(err)
 		}
@@ -613,8 +706,7 @@ func (h *Handler) saveBlob(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err != nil {
-		_ = tf.Close()
-		_ = os.Remove(tf.Name())
+		_ = tf.Abort()
 		h.incrementRepoSpaceUsage(-written)
 		if h.opt.Debug {
 			log.Print(err)
@@ -639,24 +731,8 @@ func (h *Handler) saveBlob(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	syncNotSup, err := syncFile(tf)
+	syncNotSup, err := tf.Commit()
 	if err != nil {
-		_ = tf.Close()
-		_ = os.Remove(tf.Name())
-		h.incrementRepoSpaceUsage(-written)
-		h.internalServerError(w, err)
-		return
-	}
-
-	if err := tf.Close(); err != nil {
-		_ = os.Remove(tf.Name())
-		h.incrementRepoSpaceUsage(-written)
-		h.internalServerError(w, err)
-		return
-	}
-
-	if err := os.Rename(tf.Name(), path); err != nil {
-		_ = os.Remove(tf.Name())
 		h.incrementRepoSpaceUsage(-written)
 		h.internalServerError(w, err)
 		return
@@ -666,12 +742,6 @@ func (h *Handler) saveBlob(w http.ResponseWriter, r *http.Request) {
 		h.opt.FsyncWarning.Do(func() {
 			log.Print("WARNING: fsync is not supported by the data storage. This can lead to data loss, if the system crashes or the storage is unexpectedly disconnected.")
 		})
-	} else {
-		if err := syncDir(filepath.Dir(path)); err != nil {
-			// Don't call os.Remove(path) as this is prone to race conditions with parallel upload retries
-			h.internalServerError(w, err)
-			return
-		}
 	}
 
 	h.sendMetric(objectType, BlobWrite, uint64(written))
@@ -734,22 +804,118 @@ func (h *Handler) deleteBlob(w http.ResponseWriter, r *http.Request) {
 			"cannot determine object type or id: %s", r.URL.Path))
 		return
 	}
-	if h.opt.AppendOnly && objectType != "locks" {
+	if (h.opt.AppendOnly || h.opt.ReadOnly) && objectType != "locks" {
 		httpDefaultError(w, http.StatusForbidden)
 		return
 	}
 
 	path := h.getObjectPath(objectType, objectID)
 
+	// deleted is set once the file is gone, a failed deletion must not count
+	// towards the limits of the delete guard
+	deleted := false
+	if objectType != "locks" {
+		held, err := isHeld(h.path, objectType, objectID)
+		if err != nil {
+			h.internalServerError(w, err)
+			return
+		}
+		if held {
+			if h.opt.Debug {
+				log.Printf("refusing to delete %s under legal hold", path)
+			}
+			h.sendMetric(objectType, BlobDeleteRefused, 0)
+			http.Error(w, ErrHeld.Error(), http.StatusLocked)
+			return
+		}
+
+		retained, err := h.retained(path)
+		if err != nil {
+			h.internalServerError(w, err)
+			return
+		}
+		if retained {
+			if h.opt.Debug {
+				log.Printf("refusing to delete %s within the minimum retention period", path)
+			}
+			h.sendMetric(objectType, BlobDeleteRefused, 0)
+			httpDefaultError(w, http.StatusForbidden)
+			return
+		}
+
+		if h.opt.DeleteGuard != nil {
+			undo, err := h.opt.DeleteGuard.check(h.path, objectType, path, h.opt.Username)
+			if errors.Is(err, ErrFrozen) {
+				h.sendMetric(objectType, BlobDeleteRefused, 0)
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+			if err != nil {
+				h.internalServerError(w, err)
+				return
+			}
+			if undo != nil {
+				defer func() {
+					if !deleted {
+						undo()
+					}
+				}()
+			}
+		}
+	}
+
 	var size int64
 	if h.needSize() {
-		stat, err := os.Stat(path)
+		stat, err := h.storage.Stat(path)
 		if err == nil {
 			size = stat.Size()
 		}
 	}
 
-	if err := os.Remove(path); err != nil {
+	if h.opt.Protected && needsApproval(objectType) {
+		// report success to the client, the file is hidden until the
+		// deletion is approved or rejected
+		rel, err := filepath.Rel(h.path, path)
+		if err != nil {
+			h.internalServerError(w, err)
+			return
+		}
+		metaSize, err := h.moveAside(PendingDir, filepath.ToSlash(rel))
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				h.fileAccessError(w, err)
+			}
+			return
+		}
+		deleted = true
+		h.incrementRepoSpaceUsage(metaSize)
+		if h.opt.Debug {
+			log.Printf("deletion of %s awaits approval", path)
+		}
+		return
+	}
+
+	if h.opt.Trash && objectType != "locks" {
+		// the file still uses space until it is purged from the trash
+		rel, err := filepath.Rel(h.path, path)
+		if err != nil {
+			h.internalServerError(w, err)
+			return
+		}
+		metaSize, err := h.moveToTrash(filepath.ToSlash(rel))
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				h.fileAccessError(w, err)
+			}
+			return
+		}
+		deleted = true
+		h.incrementRepoSpaceUsage(metaSize)
+		h.sendMetric(objectType, BlobDelete, uint64(size))
+		return
+	}
+
+	if err := h.storage.Remove(path); err != nil {
 		// ignore not exist errors to make deleting idempotent, which is
 		// necessary to properly handle request retries
 		if !errors.Is(err, os.ErrNotExist) {
@@ -757,6 +923,7 @@ func (h *Handler) deleteBlob(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	deleted = true
 
 	h.incrementRepoSpaceUsage(-size)
 	h.sendMetric(objectType, BlobDelete, uint64(size))
@@ -773,15 +940,20 @@ func (h *Handler) createRepo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if h.opt.ReadOnly {
+		httpDefaultError(w, http.StatusForbidden)
+		return
+	}
+
 	log.Printf("Creating repository directories in %s\n", h.path)
 
-	if err := os.MkdirAll(h.path, h.opt.dirMode); err != nil {
+	if err := h.storage.MkdirAll(h.path); err != nil {
 		h.internalServerError(w, err)
 		return
 	}
 
 	for _, d := range ObjectTypes {
-		if err := os.Mkdir(filepath.Join(h.path, d), h.opt.dirMode); err != nil && !os.IsExist(err) {
+		if err := h.storage.MkdirAll(filepath.Join(h.path, d)); err != nil {
 			h.internalServerError(w, err)
 			return
 		}
@@ -789,7 +961,7 @@ func (h *Handler) createRepo(w http.ResponseWriter, r *http.Request) {
 
 	for i := 0; i < 256; i++ {
 		dirPath := filepath.Join(h.path, "data", fmt.Sprintf("%02x", i))
-		if err := os.Mkdir(dirPath, h.opt.dirMode); err != nil && !os.IsExist(err) {
+		if err := h.storage.MkdirAll(dirPath); err != nil {
 			h.internalServerError(w, err)
 			return
 		}
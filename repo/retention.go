@@ -0,0 +1,96 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// RetentionFile is the name of a file within a repository which extends
+// Options.MinRetention for that repository. It contains a duration in the
+// format accepted by time.ParseDuration, for example "720h". A duration
+// shorter than Options.MinRetention has no effect.
+const RetentionFile = ".retention"
+
+// minRetention returns the minimum age of files which may be deleted.
+func (h *Handler) minRetention() (time.Duration, error) {
+	return EffectiveRetention(h.path, h.opt.MinRetention)
+}
+
+// EffectiveRetention returns the minimum retention for the repository at
+// repoPath, which is the longer one of serverRetention and the duration in its
+// RetentionFile.
+func EffectiveRetention(repoPath string, serverRetention time.Duration) (time.Duration, error) {
+	fn := filepath.Join(repoPath, RetentionFile)
+	data, err := os.ReadFile(fn)
+	if errors.Is(err, os.ErrNotExist) {
+		return serverRetention, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(string(data)))
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid retention in %s: %q", fn, strings.TrimSpace(string(data)))
+	}
+	return max(serverRetention, d), nil
+}
+
+// HasRetainedFiles returns true if the repository at repoPath contains files
+// other than locks which are younger than its effective retention, so that
+// the repository must not be deleted.
+func HasRetainedFiles(repoPath string, serverRetention time.Duration) (bool, error) {
+	retention, err := EffectiveRetention(repoPath, serverRetention)
+	if err != nil || retention == 0 {
+		return false, err
+	}
+
+	errRetained := errors.New("retained")
+	err = filepath.WalkDir(repoPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && path == filepath.Join(repoPath, "locks") {
+			return filepath.SkipDir
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		fi, err := d.Info()
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if time.Since(fi.ModTime()) < retention {
+			return errRetained
+		}
+		return nil
+	})
+	if errors.Is(err, errRetained) {
+		return true, nil
+	}
+	return false, err
+}
+
+// retained returns true if the file at path is younger than the minimum
+// retention and must not be deleted.
+func (h *Handler) retained(path string) (bool, error) {
+	retention, err := h.minRetention()
+	if err != nil || retention == 0 {
+		return false, err
+	}
+	stat, err := h.storage.Stat(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	return time.Since(stat.ModTime()) < retention, nil
+}
@@ -0,0 +1,170 @@
+package repo
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// QuarantineDir is the directory within a repository which holds files found
+// to be corrupt by Scrub.
+const QuarantineDir = ".quarantine"
+
+// ScrubOptions configure Scrub.
+type ScrubOptions struct {
+	// Rate limits the number of bytes read per second, 0 means no limit.
+	Rate int64
+	// Quarantine moves corrupt files to QuarantineDir, except for objects
+	// under legal hold, which are only reported.
+	Quarantine bool
+}
+
+// ScrubResult summarizes a run of Scrub.
+type ScrubResult struct {
+	Files int
+	Bytes int64
+	// Corrupt lists the paths of corrupt files relative to the repository.
+	Corrupt []string
+	// QuarantineBytes is the number of bytes used by the metadata of
+	// quarantined files.
+	QuarantineBytes int64
+}
+
+// scrubLimiter limits the number of bytes read per second.
+type scrubLimiter struct {
+	rate  int64
+	start time.Time
+	n     int64
+}
+
+// wait records that n bytes were read and sleeps until reading them is within
+// the rate.
+func (l *scrubLimiter) wait(ctx context.Context, n int) error {
+	if l.rate <= 0 {
+		return ctx.Err()
+	}
+	l.n += int64(n)
+	due := time.Duration(float64(l.n) / float64(l.rate) * float64(time.Second))
+	delay := due - time.Since(l.start)
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// hashFile returns the SHA-256 hash of the file at path.
+func hashFile(ctx context.Context, path string, lim *scrubLimiter, buf []byte) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	hasher := sha256.New()
+	var size int64
+	for {
+		n, err := f.Read(buf)
+		_, _ = hasher.Write(buf[:n])
+		size += int64(n)
+		if werr := lim.wait(ctx, n); werr != nil {
+			return "", size, werr
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", size, err
+		}
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), size, nil
+}
+
+// Scrub reads all files in the repository at repoPath except locks and checks
+// that their SHA-256 hash matches their name.
+func Scrub(ctx context.Context, repoPath string, opt ScrubOptions) (ScrubResult, error) {
+	var res ScrubResult
+	h, err := New(repoPath, Options{Username: "scrub"})
+	if err != nil {
+		return res, err
+	}
+
+	lim := &scrubLimiter{rate: opt.Rate, start: time.Now()}
+	buf := make([]byte, 256*1024)
+	for _, objectType := range ObjectTypes {
+		if objectType == "locks" {
+			continue
+		}
+		err := filepath.WalkDir(filepath.Join(repoPath, objectType), func(path string, d fs.DirEntry, err error) error {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if !d.Type().IsRegular() || !BlobPathRE.MatchString("/"+objectType+"/"+d.Name()) {
+				return nil
+			}
+
+			hash, size, err := hashFile(ctx, path, lim, buf)
+			res.Bytes += size
+			if errors.Is(err, os.ErrNotExist) {
+				// deleted in the meantime
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			res.Files++
+			if hash == d.Name() {
+				return nil
+			}
+
+			rel, err := filepath.Rel(repoPath, path)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			res.Corrupt = append(res.Corrupt, rel)
+			if opt.Quarantine {
+				// held objects must stay in place, even if they are corrupt
+				held, err := isHeld(repoPath, objectType, d.Name())
+				if err != nil {
+					return err
+				}
+				if held {
+					return nil
+				}
+				metaSize, err := h.moveAside(QuarantineDir, rel)
+				if err != nil && !errors.Is(err, os.ErrNotExist) {
+					return err
+				}
+				res.QuarantineBytes += metaSize
+			}
+			return nil
+		})
+		if err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+// ListQuarantine returns the files quarantined in the repository at repoPath.
+func ListQuarantine(repoPath string) ([]TrashEntry, error) {
+	return listAside(repoPath, QuarantineDir)
+}
@@ -0,0 +1,196 @@
+package repo
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Storage holds the files of repositories which are accessed by clients, that
+// is the config and the objects. The paths passed to its methods are filesystem
+// paths within the directory of a repository, as used by Handler.
+//
+// Other files, such as the trash, pending deletions, legal holds, the state of
+// the delete guard, the retention file and quarantined files, are always
+// accessed in the local filesystem. The features using them can therefore only
+// be used with FileStorage.
+type Storage interface {
+	// Stat returns information about the file at path.
+	Stat(path string) (os.FileInfo, error)
+	// Open opens the file at path for reading.
+	Open(path string) (File, error)
+	// Create returns a file which is stored at path once it is committed.
+	// Until then, the file is not visible. Missing directories are created.
+	Create(path string) (TempFile, error)
+	// CreateExclusive is like Create, but committing the file fails with an
+	// error matching os.ErrExist if a file at path already exists.
+	CreateExclusive(path string) (TempFile, error)
+	// List returns the files of objectType in the repository at repoPath.
+	List(repoPath string, objectType string) ([]Blob, error)
+	// Remove removes the file at path.
+	Remove(path string) error
+	// MkdirAll creates the directory at path and its parents.
+	MkdirAll(path string) error
+}
+
+// File is a file opened for reading by a Storage.
+type File interface {
+	io.ReadSeekCloser
+	Stat() (os.FileInfo, error)
+}
+
+// TempFile is a file which is being created by a Storage.
+type TempFile interface {
+	io.Writer
+	// Commit atomically stores the file at its final path. If the storage
+	// does not support syncing files, syncNotSup is true.
+	Commit() (syncNotSup bool, err error)
+	// Abort discards the file.
+	Abort() error
+}
+
+// FileStorage stores files in the local filesystem.
+type FileStorage struct {
+	DirMode  os.FileMode
+	FileMode os.FileMode
+}
+
+// Stat returns information about the file at path.
+func (s *FileStorage) Stat(path string) (os.FileInfo, error) {
+	return os.Stat(path)
+}
+
+// Open opens the file at path for reading.
+func (s *FileStorage) Open(path string) (File, error) {
+	return os.Open(path)
+}
+
+// Create creates a temporary file next to path, which is renamed to path once
+// it is committed.
+func (s *FileStorage) Create(path string) (TempFile, error) {
+	return s.create(path, false)
+}
+
+// CreateExclusive creates a temporary file next to path, which is linked to
+// path once it is committed, which fails if path already exists.
+func (s *FileStorage) CreateExclusive(path string) (TempFile, error) {
+	return s.create(path, true)
+}
+
+func (s *FileStorage) create(path string, exclusive bool) (TempFile, error) {
+	tmpFn := path + ".rest-server-temp"
+	tf, err := tempFile(tmpFn, s.FileMode)
+	if os.IsNotExist(err) {
+		// the error is caused by a missing directory, create it and retry
+		if mkdirErr := os.MkdirAll(filepath.Dir(path), s.DirMode); mkdirErr != nil {
+			return nil, mkdirErr
+		}
+		tf, err = tempFile(tmpFn, s.FileMode)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &fileTemp{File: tf, path: path, exclusive: exclusive}, nil
+}
+
+// fileTemp is a temporary file created by FileStorage.
+type fileTemp struct {
+	*os.File
+	path      string
+	exclusive bool
+}
+
+// link stores the temporary file at its final path, which must not exist if
+// the file was created exclusively.
+func (f *fileTemp) link() error {
+	if !f.exclusive {
+		return os.Rename(f.Name(), f.path)
+	}
+	if err := os.Link(f.Name(), f.path); err != nil {
+		return err
+	}
+	return os.Remove(f.Name())
+}
+
+func (f *fileTemp) Commit() (bool, error) {
+	syncNotSup, err := syncFile(f.File)
+	if err != nil {
+		_ = f.Abort()
+		return false, err
+	}
+	if err := f.File.Close(); err != nil {
+		_ = os.Remove(f.Name())
+		return false, err
+	}
+	if err := f.link(); err != nil {
+		_ = os.Remove(f.Name())
+		return false, err
+	}
+	if !syncNotSup {
+		// Don't remove the file if this fails, as this is prone to race
+		// conditions with parallel upload retries
+		if err := syncDir(filepath.Dir(f.path)); err != nil {
+			return false, err
+		}
+	}
+	return syncNotSup, nil
+}
+
+func (f *fileTemp) Abort() error {
+	_ = f.File.Close()
+	return os.Remove(f.Name())
+}
+
+// List returns the files of objectType in the repository at repoPath. For
+// hashed object types, files in the intermediate directory are ignored.
+func (s *FileStorage) List(repoPath string, objectType string) ([]Blob, error) {
+	path := filepath.Join(repoPath, objectType)
+	items, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	blobs := []Blob{}
+	add := func(entries []os.DirEntry) error {
+		for _, e := range entries {
+			fi, err := e.Info()
+			if errors.Is(err, os.ErrNotExist) {
+				// removed in the meantime
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			blobs = append(blobs, Blob{Name: e.Name(), Size: fi.Size()})
+		}
+		return nil
+	}
+
+	if !isHashed(objectType) {
+		return blobs, add(items)
+	}
+	for _, i := range items {
+		if !i.IsDir() {
+			continue
+		}
+		subitems, err := os.ReadDir(filepath.Join(path, i.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if err := add(subitems); err != nil {
+			return nil, err
+		}
+	}
+	return blobs, nil
+}
+
+// Remove removes the file at path.
+func (s *FileStorage) Remove(path string) error {
+	return os.Remove(path)
+}
+
+// MkdirAll creates the directory at path and its parents.
+func (s *FileStorage) MkdirAll(path string) error {
+	return os.MkdirAll(path, s.DirMode)
+}
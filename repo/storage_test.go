@@ -0,0 +1,123 @@
+package repo
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMemoryStorage(t *testing.T) {
+	storage := NewMemoryStorage()
+	h, err := New("/srv/restic", Options{Storage: storage, PanicOnError: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := "memory storage test"
+	hash := sha256.Sum256([]byte(data))
+	fileID := hex.EncodeToString(hash[:])
+
+	for _, test := range []struct {
+		method, path, body string
+		code               int
+		want               string
+	}{
+		{"GET", "/data/", "", http.StatusNotFound, ""},
+		{"POST", "/?create=true", "", http.StatusOK, ""},
+		{"POST", "/config", "config", http.StatusOK, ""},
+		{"POST", "/data/" + fileID, data, http.StatusOK, ""},
+		{"POST", "/keys/" + fileID, data, http.StatusOK, ""},
+		{"POST", "/config", "other", http.StatusForbidden, ""},
+		{"GET", "/config", "", http.StatusOK, "config"},
+		{"POST", "/data/" + fileID, data, http.StatusForbidden, ""},
+		{"POST", "/index/" + fileID, "wrong", http.StatusBadRequest, ""},
+		{"HEAD", "/data/" + fileID, "", http.StatusOK, ""},
+		{"GET", "/data/" + fileID, "", http.StatusOK, data},
+		{"GET", "/data/", "", http.StatusOK, `["` + fileID + `"]`},
+		{"GET", "/keys/", "", http.StatusOK, `["` + fileID + `"]`},
+		{"GET", "/index/", "", http.StatusOK, `[]`},
+		{"DELETE", "/data/" + fileID, "", http.StatusOK, ""},
+		{"GET", "/data/" + fileID, "", http.StatusNotFound, ""},
+		{"DELETE", "/data/" + fileID, "", http.StatusOK, ""},
+		{"GET", "/data/", "", http.StatusOK, `[]`},
+	} {
+		req := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		if rr.Code != test.code {
+			t.Errorf("%v %v: want code %v, got %v", test.method, test.path, test.code, rr.Code)
+		}
+		if test.want != "" && strings.TrimSpace(rr.Body.String()) != test.want {
+			t.Errorf("%v %v: want body %q, got %q", test.method, test.path, test.want, rr.Body.String())
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/keys/", nil)
+	req.Header.Set("Accept", "application/vnd.x.restic.rest.v2")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	want := `[{"name":"` + fileID + `","size":19}]`
+	if got := strings.TrimSpace(rr.Body.String()); rr.Code != http.StatusOK || got != want {
+		t.Errorf("want %v %q, got %v %q", http.StatusOK, want, rr.Code, got)
+	}
+}
+
+func TestStorageCreateExclusive(t *testing.T) {
+	for name, storage := range map[string]Storage{
+		"file":   &FileStorage{},
+		"memory": NewMemoryStorage(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "repo", "config")
+			if err := storage.MkdirAll(filepath.Dir(path)); err != nil {
+				t.Fatal(err)
+			}
+
+			// two concurrent uploads of the config, only the first to be
+			// committed must be stored
+			first, err := storage.CreateExclusive(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			second, err := storage.CreateExclusive(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for f, data := range map[TempFile]string{first: "first", second: "second"} {
+				if _, err := io.WriteString(f, data); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := first.Commit(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := second.Commit(); !errors.Is(err, os.ErrExist) {
+				t.Fatalf("want error matching os.ErrExist, got %v", err)
+			}
+
+			f, err := storage.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = f.Close() }()
+			buf, err := io.ReadAll(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(buf) != "first" {
+				t.Errorf("want %q, got %q", "first", buf)
+			}
+
+			if _, err := os.Stat(path + ".rest-server-temp"); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("temporary file was not removed: %v", err)
+			}
+		})
+	}
+}
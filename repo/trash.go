@@ -0,0 +1,202 @@
+package repo
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// TrashDir is the directory within a repository which holds deleted files if
+// Options.Trash is set.
+const TrashDir = ".trash"
+
+// TrashEntry describes a deleted file in the trash of a repository. The file
+// itself is stored as .trash/<ID>, its metadata as .trash/<ID>.json.
+type TrashEntry struct {
+	ID      string    `json:"-"`
+	Path    string    `json:"path"` // original path relative to the repository
+	User    string    `json:"user"`
+	Deleted time.Time `json:"deleted"`
+	Size    int64     `json:"size"`
+}
+
+// moveToTrash moves the file at relPath into the trash and returns the number
+// of bytes used by the metadata.
+func (h *Handler) moveToTrash(relPath string) (int64, error) {
+	return h.moveAside(TrashDir, relPath)
+}
+
+// moveAside moves the file at relPath into the directory dir within the
+// repository, together with a metadata file describing it. It returns the
+// number of bytes used by the metadata.
+func (h *Handler) moveAside(dir string, relPath string) (int64, error) {
+	path := filepath.Join(h.path, filepath.FromSlash(relPath))
+	stat, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+
+	target := filepath.Join(h.path, dir)
+	if err := os.MkdirAll(target, h.opt.dirMode); err != nil {
+		return 0, err
+	}
+
+	var rnd [4]byte
+	if _, err := rand.Read(rnd[:]); err != nil {
+		return 0, err
+	}
+	now := time.Now().UTC()
+	id := fmt.Sprintf("%s-%s-%s", now.Format("20060102T150405"), hex.EncodeToString(rnd[:]), filepath.Base(path))
+
+	meta, err := json.Marshal(TrashEntry{Path: relPath, User: h.opt.Username, Deleted: now, Size: stat.Size()})
+	if err != nil {
+		return 0, err
+	}
+	metaPath := filepath.Join(target, id+".json")
+	if err := os.WriteFile(metaPath, meta, h.opt.fileMode); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(path, filepath.Join(target, id)); err != nil {
+		_ = os.Remove(metaPath)
+		return 0, err
+	}
+	return int64(len(meta)), nil
+}
+
+// validTrashID returns true if id can refer to an entry in the trash.
+func validTrashID(id string) bool {
+	return id != "" && !strings.ContainsAny(id, `/\`) && id != "." && id != ".." && !strings.HasSuffix(id, ".json")
+}
+
+// ListTrash returns the entries in the trash of the repository at repoPath.
+func ListTrash(repoPath string) ([]TrashEntry, error) {
+	return listAside(repoPath, TrashDir)
+}
+
+// listAside returns the entries in the directory dir of the repository at
+// repoPath, which were moved there by moveAside.
+func listAside(repoPath string, dir string) ([]TrashEntry, error) {
+	files, err := os.ReadDir(filepath.Join(repoPath, dir))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []TrashEntry
+	for _, f := range files {
+		id, ok := strings.CutSuffix(f.Name(), ".json")
+		if !ok || f.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(repoPath, dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var e TrashEntry
+		if err := json.Unmarshal(data, &e); err != nil {
+			return nil, fmt.Errorf("invalid metadata %s: %w", f.Name(), err)
+		}
+		e.ID = id
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// RestoreTrash moves the file with id from the trash of the repository at
+// repoPath back to its original location, which must not exist. It returns the
+// number of bytes freed by removing the metadata.
+func RestoreTrash(repoPath string, id string) (int64, error) {
+	return restoreAside(repoPath, TrashDir, id)
+}
+
+// restoreAside moves the file with id from the directory dir of the
+// repository at repoPath back to its original location.
+func restoreAside(repoPath string, dir string, id string) (int64, error) {
+	if !validTrashID(id) {
+		return 0, os.ErrNotExist
+	}
+	metaPath := filepath.Join(repoPath, dir, id+".json")
+	data, err := os.ReadFile(metaPath)
+	if err != nil {
+		return 0, err
+	}
+	var e TrashEntry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return 0, fmt.Errorf("invalid metadata %s: %w", id, err)
+	}
+
+	target := filepath.Join(repoPath, filepath.FromSlash(e.Path))
+	if rel, err := filepath.Rel(repoPath, target); err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return 0, fmt.Errorf("invalid original path %q", e.Path)
+	}
+	if _, err := os.Lstat(target); err == nil {
+		return 0, fmt.Errorf("%s: %w", e.Path, os.ErrExist)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), DefaultDirMode); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(filepath.Join(repoPath, dir, id), target); err != nil {
+		return 0, err
+	}
+	return int64(len(data)), os.Remove(metaPath)
+}
+
+// removeAside permanently removes the file with id and its metadata from the
+// directory dir of the repository at repoPath. It returns the number of bytes
+// freed.
+func removeAside(repoPath string, dir string, id string) (int64, error) {
+	var freed int64
+	for _, name := range []string{id, id + ".json"} {
+		fn := filepath.Join(repoPath, dir, name)
+		stat, err := os.Stat(fn)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return freed, err
+		}
+		if err := os.Remove(fn); err != nil {
+			return freed, err
+		}
+		freed += stat.Size()
+	}
+	return freed, nil
+}
+
+// PurgeTrash permanently removes the files which were moved to the trash of
+// the repository at repoPath before cutoff. Files under legal hold are kept.
+// The number of bytes freed is returned.
+func PurgeTrash(repoPath string, cutoff time.Time) (int64, error) {
+	entries, err := ListTrash(repoPath)
+	if err != nil {
+		return 0, err
+	}
+
+	var freed int64
+	for _, e := range entries {
+		if !e.Deleted.Before(cutoff) {
+			continue
+		}
+		held, err := trashEntryHeld(repoPath, e)
+		if err != nil {
+			return freed, err
+		}
+		if held {
+			continue
+		}
+		n, err := removeAside(repoPath, TrashDir, e.ID)
+		freed += n
+		if err != nil {
+			return freed, err
+		}
+	}
+	return freed, nil
+}
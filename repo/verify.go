@@ -0,0 +1,108 @@
+package repo
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// errCorruptFile is returned by verifyingReader when the content of a file
+// does not match its name.
+var errCorruptFile = errors.New("file content does not match its name")
+
+// verifyingReader hashes a file while it is read from start to end. Before the
+// final bytes of a corrupt file are returned, the read fails with
+// errCorruptFile, so that the client never receives the complete file.
+type verifyingReader struct {
+	file File
+	id   string
+	size int64
+
+	hash    hash.Hash
+	pos     int64
+	full    bool // the file is read from the start
+	corrupt bool
+}
+
+func newVerifyingReader(file File, id string, size int64) *verifyingReader {
+	return &verifyingReader{file: file, id: id, size: size, hash: sha256.New(), full: true}
+}
+
+func (v *verifyingReader) Seek(offset int64, whence int) (int64, error) {
+	pos, err := v.file.Seek(offset, whence)
+	if err != nil {
+		return pos, err
+	}
+	// only reads starting at the beginning of the file can be verified
+	v.pos = pos
+	v.full = pos == 0
+	v.hash.Reset()
+	return pos, nil
+}
+
+func (v *verifyingReader) Read(p []byte) (int, error) {
+	n, err := v.file.Read(p)
+	v.pos += int64(n)
+	if !v.full {
+		return n, err
+	}
+	_, _ = v.hash.Write(p[:n])
+	if v.pos >= v.size && hex.EncodeToString(v.hash.Sum(nil)) != v.id {
+		v.corrupt = true
+		return 0, errCorruptFile
+	}
+	return n, err
+}
+
+// repairFromMirror replaces the corrupt file at path with the copy in the
+// mirror, if it is intact.
+func (h *Handler) repairFromMirror(objectType, objectID, path string) error {
+	rel, err := filepath.Rel(h.path, path)
+	if err != nil {
+		return err
+	}
+	mirrorPath := filepath.Join(h.opt.MirrorPath, rel)
+	hash, _, err := hashFile(context.Background(), mirrorPath, &scrubLimiter{}, make([]byte, 256*1024))
+	if err != nil {
+		return err
+	}
+	if hash != objectID {
+		return fmt.Errorf("mirror copy %s is corrupt as well", mirrorPath)
+	}
+
+	src, err := os.Open(mirrorPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = src.Close()
+	}()
+	tmpFn := filepath.Join(filepath.Dir(path), objectID+".rest-server-temp")
+	tf, err := os.OpenFile(tmpFn, os.O_CREATE|os.O_WRONLY|os.O_EXCL, h.opt.fileMode)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tf, src)
+	if err == nil {
+		err = tf.Sync()
+	}
+	if cerr := tf.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmpFn, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmpFn)
+		return err
+	}
+	log.Printf("Replaced corrupt %s/%s with the copy from %s", objectType, objectID, mirrorPath)
+	return syncDir(filepath.Dir(path))
+}
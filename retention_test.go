@@ -0,0 +1,83 @@
+package restserver
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/restic/rest-server/repo"
+)
+
+func TestMinRetention(t *testing.T) {
+	mux, data, fileID, tempdir, cleanup := createTestHandler(t, &Server{
+		NoAuth:       true,
+		MinRetention: time.Hour,
+		PanicOnError: true,
+	})
+	defer cleanup()
+
+	for _, req := range []*http.Request{
+		newRequest(t, "POST", "/?create=true", nil),
+		newRequest(t, "POST", "/data/"+fileID, strings.NewReader(data)),
+		newRequest(t, "POST", "/snapshots/"+fileID, strings.NewReader(data)),
+		newRequest(t, "POST", "/locks/"+fileID, strings.NewReader(data)),
+	} {
+		checkRequest(t, mux.ServeHTTP, req, []wantFunc{wantCode(http.StatusOK)})
+	}
+
+	// recent files cannot be deleted, except for locks, and the config cannot
+	// be deleted at all
+	if err := os.WriteFile(filepath.Join(tempdir, "config"), []byte("config"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(filepath.Join(tempdir, "config"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	checkRequest(t, mux.ServeHTTP, newRequest(t, "DELETE", "/config", nil), []wantFunc{wantCode(http.StatusForbidden)})
+	checkRequest(t, mux.ServeHTTP, newRequest(t, "GET", "/config", nil), []wantFunc{wantCode(http.StatusOK), wantBody("config")})
+	checkRequest(t, mux.ServeHTTP, newRequest(t, "DELETE", "/data/"+fileID, nil), []wantFunc{wantCode(http.StatusForbidden)})
+	checkRequest(t, mux.ServeHTTP, newRequest(t, "DELETE", "/snapshots/"+fileID, nil), []wantFunc{wantCode(http.StatusForbidden)})
+	checkRequest(t, mux.ServeHTTP, newRequest(t, "DELETE", "/locks/"+fileID, nil), []wantFunc{wantCode(http.StatusOK)})
+
+	// old files can be deleted
+	if err := os.Chtimes(filepath.Join(tempdir, "data", fileID[:2], fileID), old, old); err != nil {
+		t.Fatal(err)
+	}
+	checkRequest(t, mux.ServeHTTP, newRequest(t, "DELETE", "/data/"+fileID, nil), []wantFunc{wantCode(http.StatusOK)})
+
+	// the retention can be extended per repository, but not shortened
+	if err := os.Chtimes(filepath.Join(tempdir, "snapshots", fileID), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tempdir, repo.RetentionFile), []byte("3h\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	checkRequest(t, mux.ServeHTTP, newRequest(t, "DELETE", "/snapshots/"+fileID, nil), []wantFunc{wantCode(http.StatusForbidden)})
+	if err := os.WriteFile(filepath.Join(tempdir, repo.RetentionFile), []byte("0s\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if retention, err := repo.EffectiveRetention(tempdir, time.Hour); err != nil || retention != time.Hour {
+		t.Fatalf("retention file shortened the retention to %v: %v", retention, err)
+	}
+	checkRequest(t, mux.ServeHTTP, newRequest(t, "DELETE", "/snapshots/"+fileID, nil), []wantFunc{wantCode(http.StatusOK)})
+}
+
+func TestAdminDeleteRepoRetention(t *testing.T) {
+	_, tempdir, request := adminTestHandler(t, &Server{MinRetention: time.Hour})
+
+	if rr := request("DELETE", "/_admin/repos/alice", ""); rr.Code != http.StatusForbidden {
+		t.Fatalf("delete recent repository: want %v, got %v", http.StatusForbidden, rr.Code)
+	}
+
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(filepath.Join(tempdir, "alice", "config"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if rr := request("DELETE", "/_admin/repos/alice", ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("delete old repository: want %v, got %v", http.StatusNoContent, rr.Code)
+	}
+}
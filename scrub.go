@@ -0,0 +1,59 @@
+package restserver
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/restic/rest-server/repo"
+)
+
+// ScrubRepos checks the integrity of all repositories below dataPath using
+// repo.Scrub and calls report for each of them.
+func ScrubRepos(ctx context.Context, dataPath string, opt repo.ScrubOptions, report func(repoPath string, res repo.ScrubResult, err error)) error {
+	return walkRepos(dataPath, func(fsPath, repoPath string) error {
+		res, err := repo.Scrub(ctx, fsPath, opt)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		report(repoPath, res, err)
+		return nil
+	})
+}
+
+// scrubber periodically checks the integrity of all repositories.
+func (s *Server) scrubber() {
+	for {
+		s.scrub(context.Background())
+		time.Sleep(s.ScrubInterval)
+	}
+}
+
+// scrub checks the integrity of all repositories once, quarantines corrupt
+// files and updates the metrics.
+func (s *Server) scrub(ctx context.Context) {
+	opt := repo.ScrubOptions{Rate: s.ScrubRate, Quarantine: true}
+	err := ScrubRepos(ctx, s.Path, opt, func(repoPath string, res repo.ScrubResult, err error) {
+		label := strings.TrimPrefix(repoPath, "/")
+		metricScrubBytesTotal.WithLabelValues(label).Add(float64(res.Bytes))
+		metricScrubCorruptTotal.WithLabelValues(label).Add(float64(len(res.Corrupt)))
+		if s.quotaManager != nil {
+			s.quotaManager.IncUsage(res.QuarantineBytes)
+		}
+		for _, fn := range res.Corrupt {
+			log.Printf("Scrub: %s/%s is corrupt, moved to %s", repoPath, fn, repo.QuarantineDir)
+		}
+		if err != nil {
+			log.Printf("Could not scrub %s: %v", repoPath, err)
+			return
+		}
+		metricScrubLastTimestamp.WithLabelValues(label).Set(float64(time.Now().Unix()))
+		if s.Debug {
+			log.Printf("Scrubbed %d files with %d bytes in %s", res.Files, res.Bytes, repoPath)
+		}
+	})
+	if err != nil {
+		log.Printf("Could not scrub repositories: %v", err)
+	}
+}
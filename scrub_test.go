@@ -0,0 +1,95 @@
+package restserver
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/restic/rest-server/repo"
+)
+
+func TestScrub(t *testing.T) {
+	server := &Server{
+		NoAuth:       true,
+		PanicOnError: true,
+	}
+	mux, data, fileID, tempdir, cleanup := createTestHandler(t, server)
+	defer cleanup()
+
+	for _, req := range []*http.Request{
+		newRequest(t, "POST", "/?create=true", nil),
+		newRequest(t, "POST", "/config", strings.NewReader("config")),
+		newRequest(t, "POST", "/data/"+fileID, strings.NewReader(data)),
+		newRequest(t, "POST", "/snapshots/"+fileID, strings.NewReader(data)),
+	} {
+		checkRequest(t, mux.ServeHTTP, req, []wantFunc{wantCode(http.StatusOK)})
+	}
+
+	res, err := repo.Scrub(context.Background(), tempdir, repo.ScrubOptions{Quarantine: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Files != 2 || res.Bytes != 2*int64(len(data)) || len(res.Corrupt) != 0 {
+		t.Fatalf("unexpected result for intact repository %+v", res)
+	}
+
+	// flip a bit in the data file
+	fn := filepath.Join(tempdir, "data", fileID[:2], fileID)
+	buf, err := os.ReadFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf[0] ^= 1
+	if err := os.WriteFile(fn, buf, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	server.scrub(context.Background())
+
+	checkRequest(t, mux.ServeHTTP, newRequest(t, "GET", "/data/"+fileID, nil), []wantFunc{wantCode(http.StatusNotFound)})
+	checkRequest(t, mux.ServeHTTP, newRequest(t, "GET", "/snapshots/"+fileID, nil), []wantFunc{wantCode(http.StatusOK), wantBody(data)})
+	entries, err := repo.ListQuarantine(tempdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Path != "data/"+fileID[:2]+"/"+fileID {
+		t.Fatalf("unexpected quarantine entries %+v", entries)
+	}
+}
+
+func TestScrubHeld(t *testing.T) {
+	mux, data, fileID, tempdir, cleanup := createTestHandler(t, &Server{
+		NoAuth:       true,
+		PanicOnError: true,
+	})
+	defer cleanup()
+
+	for _, req := range []*http.Request{
+		newRequest(t, "POST", "/?create=true", nil),
+		newRequest(t, "POST", "/snapshots/"+fileID, strings.NewReader(data)),
+	} {
+		checkRequest(t, mux.ServeHTTP, req, []wantFunc{wantCode(http.StatusOK)})
+	}
+	if _, err := repo.PlaceHold(nil, tempdir, repo.Hold{Type: "snapshots", ID: fileID}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tempdir, "snapshots", fileID), []byte("corrupt"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// corrupt objects under legal hold are reported, but not quarantined
+	res, err := repo.Scrub(context.Background(), tempdir, repo.ScrubOptions{Quarantine: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Corrupt) != 1 || res.Corrupt[0] != "snapshots/"+fileID {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	checkRequest(t, mux.ServeHTTP, newRequest(t, "GET", "/snapshots/"+fileID, nil), []wantFunc{wantCode(http.StatusOK), wantBody("corrupt")})
+	if entries, err := repo.ListQuarantine(tempdir); err != nil || len(entries) != 0 {
+		t.Fatalf("unexpected quarantine entries %+v, %v", entries, err)
+	}
+}
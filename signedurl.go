@@ -0,0 +1,99 @@
+package restserver
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignedURLPrefix is the path prefix of signed URLs. A signed URL grants
+// read-only access to a single repository until it expires:
+//
+//	/_signed/read/<expiry as unix time>/<signature>/<repository path>/
+//
+// The signature is an HMAC-SHA256 over the scope, expiry and repository path.
+// The repository path is appended after the signature, so that restic can use
+// the signed URL as the repository URL.
+const SignedURLPrefix = "/_signed/"
+
+// minURLSigningKeyLength is the minimum length of a URL signing key in bytes.
+const minURLSigningKeyLength = 32
+
+// ReadURLSigningKey reads the key used to sign URLs from path. Leading and
+// trailing whitespace is ignored.
+func ReadURLSigningKey(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key := bytes.TrimSpace(data)
+	if len(key) < minURLSigningKeyLength {
+		return nil, fmt.Errorf("URL signing key in %s is too short, need at least %d bytes", path, minURLSigningKeyLength)
+	}
+	return key, nil
+}
+
+// urlSignature returns the signature for read access to repoPath until
+// expires.
+func urlSignature(key []byte, scope string, expires int64, repoPath string) string {
+	mac := hmac.New(sha256.New, key)
+	_, _ = fmt.Fprintf(mac, "%s\n%d\n%s", scope, expires, repoPath)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// SignURL returns the path of a signed URL which grants read-only access to
+// the repository at repoPath until expires.
+func SignURL(key []byte, repoPath string, expires time.Time) (string, error) {
+	urlPath := path.Join("/", repoPath)
+	if urlPath != "/" {
+		urlPath += "/"
+	}
+	folderPath, remainder := splitURLPath(urlPath, MaxFolderDepth)
+	if remainder != "/" || !folderPathValid(folderPath) {
+		return "", fmt.Errorf("invalid repository path %q", repoPath)
+	}
+	repoPath = "/" + strings.Join(folderPath, "/")
+	sig := urlSignature(key, "read", expires.Unix(), repoPath)
+	return fmt.Sprintf("%sread/%d/%s%s", SignedURLPrefix, expires.Unix(), sig, urlPath), nil
+}
+
+// verifySignedURL checks the signature of a request for a signed URL. On
+// success, the returned identity grants read access to the signed repository
+// and the path of the request is rewritten to the repository path.
+func (s *Server) verifySignedURL(r *http.Request) (identity, int, error) {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, SignedURLPrefix), "/", 4)
+	if len(parts) != 4 || parts[0] != "read" {
+		return identity{}, http.StatusNotFound, errors.New("malformed signed URL")
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return identity{}, http.StatusNotFound, errors.New("malformed signed URL")
+	}
+
+	urlPath := "/" + parts[3]
+	folderPath, _ := splitURLPath(urlPath, MaxFolderDepth)
+	repoPath := "/" + strings.Join(folderPath, "/")
+	want := urlSignature(s.urlSigningKey, parts[0], expires, repoPath)
+	if !hmac.Equal([]byte(want), []byte(parts[2])) {
+		return identity{}, http.StatusUnauthorized, errors.New("invalid signature")
+	}
+	if time.Now().Unix() > expires {
+		return identity{}, http.StatusUnauthorized, errors.New("signed URL expired")
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return identity{}, http.StatusForbidden, fmt.Errorf("method %s not allowed for signed URL", r.Method)
+	}
+
+	r.URL.Path = urlPath
+	r.URL.RawPath = ""
+	return identity{access: AccessRead, repos: []string{repoPath}, signed: true}, 0, nil
+}
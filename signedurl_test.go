@@ -0,0 +1,66 @@
+package restserver
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignedURL(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "url-key")
+	key := strings.Repeat("k", minURLSigningKeyLength)
+	if err := os.WriteFile(keyFile, []byte(key+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	mux, data, fileID, _, cleanup := createTestHandler(t, &Server{
+		ProxyAuthUsername: "X-Remote-User",
+		URLSigningKeyPath: keyFile,
+		PrivateRepos:      true,
+		PanicOnError:      true,
+	})
+	defer cleanup()
+
+	req := newRequest(t, "POST", "/alice/?create=true", nil)
+	req.Header.Set("X-Remote-User", "alice")
+	checkRequest(t, mux.ServeHTTP, req, []wantFunc{wantCode(http.StatusOK)})
+	req = newRequest(t, "POST", "/alice/data/"+fileID, strings.NewReader(data))
+	req.Header.Set("X-Remote-User", "alice")
+	checkRequest(t, mux.ServeHTTP, req, []wantFunc{wantCode(http.StatusOK)})
+
+	valid, err := SignURL([]byte(key), "/alice", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := SignURL([]byte(key), "/alice", time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := SignURL([]byte("other key"), "/alice", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SignURL([]byte(key), "/a/b/c", time.Now()); err == nil {
+		t.Error("too deep repository path accepted")
+	}
+
+	for _, test := range []struct {
+		method string
+		path   string
+		code   int
+	}{
+		{"GET", valid + "data/" + fileID, http.StatusOK},
+		{"HEAD", valid + "data/" + fileID, http.StatusOK},
+		{"DELETE", valid + "data/" + fileID, http.StatusForbidden},
+		{"POST", valid + "locks/" + fileID, http.StatusForbidden},
+		{"GET", expired + "data/" + fileID, http.StatusUnauthorized},
+		{"GET", other + "data/" + fileID, http.StatusUnauthorized},
+		{"GET", strings.Replace(valid, "/alice/", "/bob/", 1) + "config", http.StatusUnauthorized},
+		{"GET", valid[:len(valid)-1] + "/sub/config", http.StatusUnauthorized},
+	} {
+		checkRequest(t, mux.ServeHTTP, newRequest(t, test.method, test.path, nil), []wantFunc{wantCode(test.code)})
+	}
+}
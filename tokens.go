@@ -0,0 +1,228 @@
+package restserver
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Token is an API token stored in the token file. Only the SHA-256 hash of the
+// token itself is stored.
+type Token struct {
+	Hash     string    `json:"hash"`
+	Username string    `json:"username"`
+	Repos    []string  `json:"repos,omitempty"` // allowed repository path prefixes, all if empty
+	Scope    string    `json:"scope"`           // one of read, append or delete
+	Expires  time.Time `json:"expires,omitempty"`
+}
+
+// ID returns a short identifier for the token, which is derived from its hash.
+func (t Token) ID() string {
+	if len(t.Hash) < 12 {
+		return t.Hash
+	}
+	return t.Hash[:12]
+}
+
+// Expired returns true if the token is no longer valid at time now.
+func (t Token) Expired(now time.Time) bool {
+	return !t.Expires.IsZero() && !now.Before(t.Expires)
+}
+
+// parseTokenScope returns the access level granted by a token scope.
+func parseTokenScope(scope string) (Access, error) {
+	switch scope {
+	case "read":
+		return AccessRead, nil
+	case "append":
+		return AccessAppend, nil
+	case "delete":
+		return AccessFull, nil
+	}
+	return AccessNone, fmt.Errorf("invalid token scope %q, must be one of read, append or delete", scope)
+}
+
+// hashToken returns the hash of a token as stored in the token file.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewToken generates a new random token. It returns the token, which must be
+// passed to the client, and its hash for the token file.
+func NewToken() (token string, hash string, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token = hex.EncodeToString(buf)
+	return token, hashToken(token), nil
+}
+
+// ReadTokens reads all tokens from the token file at path.
+func ReadTokens(path string) ([]Token, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var tokens []Token
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, t := range tokens {
+		if t.Hash == "" || t.Username == "" {
+			return nil, fmt.Errorf("%s: token %q is missing hash or username", path, t.ID())
+		}
+		if _, err := parseTokenScope(t.Scope); err != nil {
+			return nil, fmt.Errorf("%s: token %q: %w", path, t.ID(), err)
+		}
+	}
+	return tokens, nil
+}
+
+// WriteTokens atomically replaces the token file at path.
+func WriteTokens(path string, tokens []Token) error {
+	if tokens == nil {
+		tokens = []Token{}
+	}
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, append(data, '\n'), 0600)
+}
+
+// AddToken adds t to the token file at path, which is created if it does not
+// exist yet.
+func AddToken(path string, t Token) error {
+	if t.Hash == "" || t.Username == "" {
+		return errors.New("token is missing hash or username")
+	}
+	if !ValidUsername(t.Username) {
+		return fmt.Errorf("invalid username %q, only letters, numbers, '_', '-', '.' and '@' are allowed", t.Username)
+	}
+	if _, err := parseTokenScope(t.Scope); err != nil {
+		return err
+	}
+
+	tokens, err := ReadTokens(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return WriteTokens(path, append(tokens, t))
+}
+
+// RemoveToken removes the token with the given ID from the token file at path.
+func RemoveToken(path string, id string) error {
+	tokens, err := ReadTokens(path)
+	if err != nil {
+		return err
+	}
+
+	kept := tokens[:0]
+	for _, t := range tokens {
+		if t.ID() != id {
+			kept = append(kept, t)
+		}
+	}
+	if len(kept) == len(tokens) {
+		return fmt.Errorf("token %q not found", id)
+	}
+	return WriteTokens(path, kept)
+}
+
+// TokenFile holds the API tokens loaded from a token file.
+type TokenFile struct {
+	mutex  sync.Mutex
+	file   *watchedFile
+	tokens map[string]Token // indexed by hash
+}
+
+// NewTokensFromFile loads the tokens from path. The file is reloaded when it
+// changes on disk or when the process receives SIGHUP.
+func NewTokensFromFile(path string) (*TokenFile, error) {
+	file, err := newWatchedFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	tf := &TokenFile{file: file}
+	if err := tf.Reload(); err != nil {
+		return nil, err
+	}
+
+	reloadOnSIGHUP("token file", tf.Reload)
+
+	return tf, nil
+}
+
+// Reload reloads the token file. If the file cannot be parsed, the previous
+// tokens are kept and the error is returned.
+func (tf *TokenFile) Reload() error {
+	list, err := ReadTokens(tf.file.path)
+	if err != nil {
+		return err
+	}
+
+	tokens := make(map[string]Token, len(list))
+	for _, t := range list {
+		tokens[t.Hash] = t
+	}
+
+	tf.mutex.Lock()
+	tf.tokens = tokens
+	tf.mutex.Unlock()
+	return nil
+}
+
+// ReloadCheck reloads the token file if it changed on disk.
+func (tf *TokenFile) ReloadCheck() {
+	if !tf.file.changed() {
+		return
+	}
+	if err := tf.Reload(); err != nil {
+		log.Printf("Could not reload token file: %v", err)
+		return
+	}
+	log.Printf("Reloaded token file")
+}
+
+// Validate returns the identity for token if it exists and has not expired.
+func (tf *TokenFile) Validate(token string) (identity, bool) {
+	tf.ReloadCheck()
+
+	tf.mutex.Lock()
+	t, ok := tf.tokens[hashToken(token)]
+	tf.mutex.Unlock()
+
+	if !ok {
+		return identity{}, false
+	}
+	if t.Expired(time.Now()) {
+		log.Printf("Expired token %s for %s.", t.ID(), t.Username)
+		return identity{}, false
+	}
+
+	// the scope was already checked while loading the file
+	access, _ := parseTokenScope(t.Scope)
+	return identity{username: t.Username, access: access, repos: t.Repos}, true
+}
+
+// bearerToken returns the token from the Authorization header of a request
+// using the Bearer scheme.
+func bearerToken(authorization string) (token string, ok bool) {
+	const prefix = "Bearer "
+	if len(authorization) < len(prefix) || !strings.EqualFold(authorization[:len(prefix)], prefix) {
+		return "", false
+	}
+	return strings.TrimSpace(authorization[len(prefix):]), true
+}
@@ -0,0 +1,189 @@
+package restserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenFile(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "tokens.json")
+
+	readToken, readHash, err := NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiredToken, expiredHash, err := NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tok := range []Token{
+		{Hash: readHash, Username: "ci", Repos: []string{"/ci"}, Scope: "read", Expires: time.Now().Add(time.Hour)},
+		{Hash: expiredHash, Username: "ci", Scope: "delete", Expires: time.Now().Add(-time.Hour)},
+	} {
+		if err := AddToken(fn, tok); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := AddToken(fn, Token{Hash: "abc", Username: "ci", Scope: "write"}); err == nil {
+		t.Fatal("token with invalid scope was accepted")
+	}
+	if err := AddToken(fn, Token{Hash: "abc", Username: "../ci", Scope: "read"}); err == nil {
+		t.Fatal("token with invalid username was accepted")
+	}
+
+	tokens, err := NewTokensFromFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, ok := tokens.Validate(readToken)
+	if !ok {
+		t.Fatal("valid token not accepted")
+	}
+	if id.username != "ci" || id.access != AccessRead {
+		t.Errorf("wrong identity for token: %+v", id)
+	}
+	if _, ok := tokens.Validate(expiredToken); ok {
+		t.Error("expired token accepted")
+	}
+	if _, ok := tokens.Validate("invalid"); ok {
+		t.Error("invalid token accepted")
+	}
+
+	if err := RemoveToken(fn, Token{Hash: readHash}.ID()); err != nil {
+		t.Fatal(err)
+	}
+	if err := tokens.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tokens.Validate(readToken); ok {
+		t.Error("removed token accepted")
+	}
+}
+
+func TestTokenHandler(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "tokens.json")
+	token, hash, err := NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = AddToken(fn, Token{Hash: hash, Username: "ci", Repos: []string{"/ci/"}, Scope: "append"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux, data, fileID, _, cleanup := createTestHandler(t, &Server{
+		TokenPath:    fn,
+		PanicOnError: true,
+	})
+	defer cleanup()
+
+	bearer := func(method, path, body string) *http.Request {
+		req := newRequest(t, method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		return req
+	}
+	basic := func(method, path, user string) *http.Request {
+		req := newRequest(t, method, path, nil)
+		req.SetBasicAuth(user, token)
+		return req
+	}
+
+	for _, test := range []struct {
+		req  *http.Request
+		code int
+	}{
+		{bearer("POST", "/ci/?create=true", ""), http.StatusOK},
+		{bearer("POST", "/ci/data/"+fileID, data), http.StatusOK},
+		{bearer("DELETE", "/ci/data/"+fileID, ""), http.StatusForbidden},
+		{bearer("POST", "/other/?create=true", ""), http.StatusForbidden},
+		{basic("GET", "/ci/data/"+fileID, "ci"), http.StatusOK},
+		{basic("GET", "/ci/data/"+fileID, "other"), http.StatusUnauthorized},
+	} {
+		checkRequest(t, mux.ServeHTTP, test.req, []wantFunc{wantCode(test.code)})
+	}
+}
+
+func TestTokenUserAttributes(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, ".htpasswd")
+	pwd := "$2y$05$z/OEmNQamd6m6LSegUErh.r/Owk9Xwmc5lxDheIuHY2Z7XiS6FtJm"
+	if err := os.WriteFile(fn, []byte("root:"+pwd+":admin\nbackup:"+pwd+":append-only\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	htpass, err := NewHtpasswdFromFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokenPath := filepath.Join(dir, "tokens.json")
+	tokens := make(map[string]string)
+	for _, user := range []string{"root", "backup"} {
+		token, hash, err := NewToken()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := AddToken(tokenPath, Token{Hash: hash, Username: user, Scope: "delete"}); err != nil {
+			t.Fatal(err)
+		}
+		tokens[user] = token
+	}
+	tf, err := NewTokensFromFile(tokenPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &Server{htpasswdFile: htpass, tokens: tf}
+
+	// the scope of a token is limited by the attributes of its user, and
+	// tokens never grant admin access
+	for user, want := range map[string]Access{
+		"root":   AccessFull,
+		"backup": AccessAppend,
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", "Bearer "+tokens[user])
+		id, ok := server.checkAuth(req)
+		if !ok {
+			t.Fatalf("%v: authentication failed", user)
+		}
+		if id.access != want || id.admin {
+			t.Errorf("%v: want access %v without admin, got %v admin %v", user, want, id.access, id.admin)
+		}
+
+		req = httptest.NewRequest("GET", "/", nil)
+		req.SetBasicAuth(user, tokens[user])
+		id, ok = server.checkAuth(req)
+		if !ok {
+			t.Fatalf("%v: authentication with password failed", user)
+		}
+		if id.access != want || id.admin {
+			t.Errorf("%v: want access %v without admin, got %v admin %v", user, want, id.access, id.admin)
+		}
+	}
+}
+
+func TestAllowedRepo(t *testing.T) {
+	id := identity{repos: []string{"/ci", "/shared/db/"}}
+	for repo, want := range map[string]bool{
+		"/ci":         true,
+		"/ci/sub":     true,
+		"/cisub":      false,
+		"/shared/db":  true,
+		"/shared":     false,
+		"/":           false,
+		"/other/repo": false,
+	} {
+		folderPath := strings.Split(strings.Trim(repo, "/"), "/")
+		if repo == "/" {
+			folderPath = nil
+		}
+		if got := id.allowedRepo(folderPath); got != want {
+			t.Errorf("%v: want %v, got %v", repo, want, got)
+		}
+	}
+}
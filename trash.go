@@ -0,0 +1,104 @@
+package restserver
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/restic/rest-server/repo"
+)
+
+// TrashPurgeInterval is how often files whose retention period has expired
+// are removed from the trash.
+const TrashPurgeInterval = time.Hour
+
+// trashPurger periodically removes expired files from the trash of all
+// repositories.
+func (s *Server) trashPurger() {
+	for {
+		s.purgeTrash(time.Now())
+		time.Sleep(TrashPurgeInterval)
+	}
+}
+
+// purgeTrash removes all files which were moved to the trash more than
+// TrashRetention before now.
+func (s *Server) purgeTrash(now time.Time) {
+	cutoff := now.Add(-s.TrashRetention)
+	err := walkRepos(s.Path, func(fsPath, repoPath string) error {
+		freed, err := repo.PurgeTrash(fsPath, cutoff)
+		if s.quotaManager != nil {
+			s.quotaManager.DecUsage(freed)
+		}
+		if err != nil {
+			log.Printf("Could not purge trash of %s: %v", repoPath, err)
+		} else if freed > 0 && s.Debug {
+			log.Printf("Purged %d bytes from the trash of %s", freed, repoPath)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Could not purge trash: %v", err)
+	}
+}
+
+func (s *Server) adminListTrash(w http.ResponseWriter, r *http.Request) {
+	fsPath, ok := s.adminRepoPath(r.PathValue("path"))
+	if !ok || !isRepo(fsPath) {
+		httpDefaultError(w, http.StatusNotFound)
+		return
+	}
+	entries, err := repo.ListTrash(fsPath)
+	if err != nil {
+		log.Printf("admin: cannot list trash of %s: %v", fsPath, err)
+		httpDefaultError(w, http.StatusInternalServerError)
+		return
+	}
+
+	type trashEntry struct {
+		ID string `json:"id"`
+		repo.TrashEntry
+	}
+	list := make([]trashEntry, 0, len(entries))
+	for _, e := range entries {
+		list = append(list, trashEntry{ID: e.ID, TrashEntry: e})
+	}
+	sendJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) adminRestoreTrash(w http.ResponseWriter, r *http.Request) {
+	fsPath, ok := s.adminRepoPath(r.PathValue("path"))
+	if !ok || !isRepo(fsPath) {
+		httpDefaultError(w, http.StatusNotFound)
+		return
+	}
+	var req struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	freed, err := repo.RestoreTrash(fsPath, req.ID)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		httpDefaultError(w, http.StatusNotFound)
+		return
+	case errors.Is(err, os.ErrExist):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("admin: cannot restore %s in %s: %v", req.ID, fsPath, err)
+		httpDefaultError(w, http.StatusInternalServerError)
+		return
+	}
+	if s.quotaManager != nil {
+		s.quotaManager.DecUsage(freed)
+	}
+	log.Printf("admin: restored %s in %s from the trash", req.ID, fsPath)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,77 @@
+package restserver
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/restic/rest-server/repo"
+)
+
+func TestTrash(t *testing.T) {
+	server := &Server{
+		NoAuth:         true,
+		TrashRetention: time.Hour,
+		MaxRepoSize:    1 << 20,
+		PanicOnError:   true,
+	}
+	mux, data, fileID, tempdir, cleanup := createTestHandler(t, server)
+	defer cleanup()
+
+	// the repository needs a config file to be found by the purger
+	for _, req := range []*http.Request{
+		newRequest(t, "POST", "/?create=true", nil),
+		newRequest(t, "POST", "/config", strings.NewReader("config")),
+		newRequest(t, "POST", "/data/"+fileID, strings.NewReader(data)),
+	} {
+		checkRequest(t, mux.ServeHTTP, req, []wantFunc{wantCode(http.StatusOK)})
+	}
+	used := server.quotaManager.SpaceUsed()
+
+	checkRequest(t, mux.ServeHTTP, newRequest(t, "DELETE", "/data/"+fileID, nil), []wantFunc{wantCode(http.StatusOK)})
+	checkRequest(t, mux.ServeHTTP, newRequest(t, "GET", "/data/"+fileID, nil), []wantFunc{wantCode(http.StatusNotFound)})
+	checkRequest(t, mux.ServeHTTP, newRequest(t, "GET", "/.trash/config", nil), []wantFunc{wantCode(http.StatusNotFound)})
+
+	entries, err := repo.ListTrash(tempdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Path != "data/"+fileID[:2]+"/"+fileID || entries[0].Size != int64(len(data)) {
+		t.Fatalf("unexpected trash entries %+v", entries)
+	}
+	if server.quotaManager.SpaceUsed() < used {
+		t.Errorf("space of trashed file was released before it was purged")
+	}
+
+	// restore the file and delete it again
+	freed, err := repo.RestoreTrash(tempdir, entries[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.quotaManager.DecUsage(freed)
+	if _, err := repo.RestoreTrash(tempdir, entries[0].ID); err == nil {
+		t.Error("restoring a file twice did not fail")
+	}
+	checkRequest(t, mux.ServeHTTP, newRequest(t, "GET", "/data/"+fileID, nil), []wantFunc{wantCode(http.StatusOK), wantBody(data)})
+	checkRequest(t, mux.ServeHTTP, newRequest(t, "DELETE", "/data/"+fileID, nil), []wantFunc{wantCode(http.StatusOK)})
+
+	// files are only purged after the retention period
+	server.purgeTrash(time.Now())
+	if entries, _ := repo.ListTrash(tempdir); len(entries) != 1 {
+		t.Fatalf("file purged before the retention period expired: %+v", entries)
+	}
+	server.purgeTrash(time.Now().Add(2 * time.Hour))
+	files, err := os.ReadDir(filepath.Join(tempdir, repo.TrashDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Errorf("trash not empty after purge: %v", files)
+	}
+	if server.quotaManager.SpaceUsed() != used-int64(len(data)) {
+		t.Errorf("space was not released by the purge, used %d before, %d after", used, server.quotaManager.SpaceUsed())
+	}
+}
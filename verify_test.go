@@ -0,0 +1,73 @@
+package restserver
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerifyRead(t *testing.T) {
+	mirror := t.TempDir()
+	mux, data, fileID, tempdir, cleanup := createTestHandler(t, &Server{
+		NoAuth:     true,
+		VerifyRead: true,
+		MirrorPath: mirror,
+	})
+	defer cleanup()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	for _, req := range []*http.Request{
+		newRequest(t, "POST", "/?create=true", nil),
+		newRequest(t, "POST", "/data/"+fileID, strings.NewReader(data)),
+	} {
+		checkRequest(t, mux.ServeHTTP, req, []wantFunc{wantCode(http.StatusOK)})
+	}
+
+	get := func() (string, error) {
+		res, err := http.Get(srv.URL + "/data/" + fileID)
+		if err != nil {
+			return "", err
+		}
+		defer func() {
+			_ = res.Body.Close()
+		}()
+		buf, err := io.ReadAll(res.Body)
+		return string(buf), err
+	}
+
+	if body, err := get(); err != nil || body != data {
+		t.Fatalf("reading intact file: got %q, %v", body, err)
+	}
+
+	fn := filepath.Join("data", fileID[:2], fileID)
+	if err := os.WriteFile(filepath.Join(tempdir, fn), []byte(strings.ToUpper(data)), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// ranges cannot be verified
+	req := newRequest(t, "GET", "/data/"+fileID, nil)
+	req.Header.Set("Range", "bytes=0-5")
+	checkRequest(t, mux.ServeHTTP, req, []wantFunc{wantCode(http.StatusPartialContent), wantBody(strings.ToUpper(data[:6]))})
+
+	if body, err := get(); err == nil {
+		t.Fatalf("reading corrupt file did not fail, got %q", body)
+	}
+
+	// with an intact copy in the mirror, the file is repaired and the
+	// retried request succeeds
+	if err := os.MkdirAll(filepath.Join(mirror, filepath.Dir(fn)), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(mirror, fn), []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = get()
+	if body, err := get(); err != nil || body != data {
+		t.Fatalf("reading repaired file: got %q, %v", body, err)
+	}
+}